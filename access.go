@@ -0,0 +1,67 @@
+package views
+
+import (
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/request"
+)
+
+// parseNets parse the list of the sources, which is either a CIDR prefix, an IP address or "*"
+func parseNets(args []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, arg := range args {
+		if arg == "*" {
+			_, v4, _ := net.ParseCIDR("0.0.0.0/0")
+			_, v6, _ := net.ParseCIDR("::/0")
+			nets = append(nets, v4, v6)
+			continue
+		}
+
+		if !strings.Contains(arg, "/") {
+			ip := net.ParseIP(arg)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: arg}
+			}
+			nets = append(nets, hostNet(ip))
+			continue
+		}
+
+		_, cidrNet, err := net.ParseCIDR(arg)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, cidrNet)
+	}
+
+	return nets, nil
+}
+
+// queryAllowed report whether the source of the query may query the plugin at all, regardless of the views,
+// the denied sources are refused even though they are allowed, and only the allowed ones may query when any is given,
+// the source is the address of the connection so the client subnet option cannot bypass it
+func (v *Views) queryAllowed(state request.Request) bool {
+	if len(v.Allow) == 0 && len(v.Deny) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return false
+	}
+
+	if netsContain(v.Deny, ip) {
+		return false
+	}
+	return len(v.Allow) == 0 || netsContain(v.Allow, ip)
+}
+
+// netsContain report whether any of the networks contains the IP
+func netsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, cidrNet := range nets {
+		if cidrNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
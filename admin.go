@@ -0,0 +1,252 @@
+package views
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// startAdmin start the admin HTTP endpoint on the configured address
+func (v *Views) startAdmin() error {
+	ln, err := net.Listen("tcp", v.Admin)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reload", v.handleReload)
+	mux.HandleFunc("/views", v.handleViews)
+	mux.HandleFunc("/match", v.handleMatch)
+
+	v.adminListener = ln
+	go func() {
+		if err := http.Serve(ln, mux); err != nil && !isClosedErr(err) {
+			log.Error(err)
+		}
+	}()
+
+	log.Infof("admin endpoint is listening on %s", ln.Addr().String())
+	return nil
+}
+
+// stopAdmin stop the admin HTTP endpoint when it is started
+func (v *Views) stopAdmin() error {
+	if v.adminListener == nil {
+		return nil
+	}
+
+	err := v.adminListener.Close()
+	v.adminListener = nil
+	return err
+}
+
+// handleReload trigger an immediate config reload and respond with its result
+func (v *Views) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	resp := make(chan error, 1)
+	select {
+	case v.trigger <- resp:
+	case <-r.Context().Done():
+		return
+	}
+
+	select {
+	case err := <-resp:
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+	case <-r.Context().Done():
+	}
+}
+
+// viewSummary represent of the summary of a loaded view served by the admin endpoint
+type viewSummary struct {
+	Name     string   `json:"name"`
+	Prefixes []string `json:"prefixes"`
+	Names    int      `json:"names"`
+	Records  int      `json:"records"`
+	Serial   uint32   `json:"serial"`
+	Disabled bool     `json:"disabled"`
+	// ServerPrefixes is the local addresses which the client is restricted to
+	ServerPrefixes []string `json:"server_prefixes,omitempty"`
+	// Annotated is the records of the view which carry the metadata
+	Annotated []annotatedRecord `json:"annotated,omitempty"`
+	// CanaryView and CanaryPercent is the alternate view of the client and the share of its clients routed there
+	CanaryView    string `json:"canary_view,omitempty"`
+	CanaryPercent int    `json:"canary_percent,omitempty"`
+}
+
+// annotatedRecord represent of a record along with its metadata served by the admin endpoint
+type annotatedRecord struct {
+	Name  string            `json:"name"`
+	Type  string            `json:"type"`
+	Value string            `json:"value"`
+	Meta  map[string]string `json:"meta"`
+}
+
+// handleViews respond with the summary of the views which are currently loaded,
+// ordered as the clients config and followed by the views having no client
+func (v *Views) handleViews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	snap := v.current()
+
+	views := []viewSummary{}
+	seen := make(map[string]bool)
+	for _, client := range snap.clientACLs {
+		prefixes := make([]string, 0, len(client.CIDRNets))
+		for _, cidrNet := range client.CIDRNets {
+			prefixes = append(prefixes, cidrNet.String())
+		}
+
+		summary := summarizeView(client.Name, prefixes, snap.clientZones[client.Name])
+		summary.Disabled = client.Disabled
+		if client.Canary != nil {
+			summary.CanaryView, summary.CanaryPercent = client.Canary.View, client.Canary.Percent
+		}
+		for _, serverNet := range client.ServerNets {
+			summary.ServerPrefixes = append(summary.ServerPrefixes, serverNet.String())
+		}
+		views = append(views, summary)
+		seen[client.Name] = true
+	}
+
+	names := make([]string, 0, len(snap.clientZones))
+	for name := range snap.clientZones {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		views = append(views, summarizeView(name, []string{}, snap.clientZones[name]))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"fallback": v.Fallback,
+		"views":    views,
+		"sources":  snap.freshness(v, time.Now()),
+	})
+}
+
+// handleMatch respond with the view that the given IP address would be matched to, along with
+// the optional server IP receiving the query and the query name, using the same matching as the one of the queries,
+// e.g. GET /match?ip=10.1.2.3&server=10.0.0.53&name=app.dev.example.com
+func (v *Views) handleMatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	ip := net.ParseIP(r.URL.Query().Get("ip"))
+	if ip == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid or missing ip parameter"})
+		return
+	}
+
+	var server net.IP
+	if s := r.URL.Query().Get("server"); s != "" {
+		if server = net.ParseIP(s); server == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid server parameter"})
+			return
+		}
+		if server4 := server.To4(); server4 != nil {
+			server = server4
+		}
+	}
+
+	clientNet := hostNet(ip)
+	resp := map[string]interface{}{
+		"ip":       clientNet.IP.String(),
+		"view":     nil,
+		"prefix":   nil,
+		"pattern":  nil,
+		"canary":   false,
+		"fallback": false,
+	}
+
+	snap := v.current()
+	client, cidrNet := matchClient(snap.clientACLs, clientNet, server)
+
+	var view, pattern string
+	if name := r.URL.Query().Get("name"); name != "" {
+		view, pattern = v.nameView(snap, plugin.Host(name).Normalize(), client != nil)
+	}
+
+	if view != "" {
+		resp["view"] = view
+		resp["pattern"] = pattern
+	} else if client != nil {
+		resp["view"] = client.view(clientNet)
+		resp["prefix"] = cidrNet.String()
+		resp["canary"] = client.Canary != nil && resp["view"] != client.Name
+	} else if v.Fallback != "" {
+		resp["view"] = v.Fallback
+		resp["fallback"] = true
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func summarizeView(name string, prefixes []string, zones Zones) viewSummary {
+	summary := viewSummary{
+		Name:     name,
+		Prefixes: prefixes,
+		Names:    len(zones.Names),
+		Serial:   zones.Serial,
+	}
+	for _, name := range zones.Names {
+		node := zones.Z[name]
+
+		qtypes := make([]int, 0, len(node))
+		for qtype, zs := range node {
+			qtypes = append(qtypes, int(qtype))
+			summary.Records += len(zs)
+		}
+		sort.Ints(qtypes)
+
+		for _, qtype := range qtypes {
+			for _, z := range node[uint16(qtype)] {
+				if len(z.Meta) > 0 {
+					summary.Annotated = append(summary.Annotated, annotatedRecord{
+						Name:  z.Name,
+						Type:  dns.TypeToString[z.Type],
+						Value: z.Value,
+						Meta:  z.Meta,
+					})
+				}
+			}
+		}
+	}
+	return summary
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error(err)
+	}
+}
+
+func isClosedErr(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		return opErr.Err.Error() == "use of closed network connection"
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package views
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+)
+
+// Canary represent of the share of the clients of a client ACL which are routed to an alternate view,
+// the clients are picked by the hash of their IP so each of them sticks to the same view across the queries
+type Canary struct {
+	View    string
+	Percent int
+}
+
+// RawCanary represent specification of the canary of a client ACL, e.g.
+//
+//	canary:
+//	  view: office-next
+//	  percent: 10
+type RawCanary struct {
+	View    string `yaml:"view" json:"view"`
+	Percent int    `yaml:"percent" json:"percent"`
+}
+
+// newCanary build the canary of the client ACL from its raw specification
+func newCanary(raw RawCanary) (*Canary, error) {
+	if raw.View == "" {
+		return nil, fmt.Errorf("canary view is required")
+	}
+	if raw.Percent < 0 || raw.Percent > 100 {
+		return nil, fmt.Errorf("invalid canary percent: %d", raw.Percent)
+	}
+	return &Canary{View: raw.View, Percent: raw.Percent}, nil
+}
+
+// view return the view of the client network which is matched to the client ACL,
+// that is the canary view for the share of the clients picked by the canary, otherwise the view of the client ACL
+func (c *ClientACL) view(clientNet *net.IPNet) string {
+	if c.Canary == nil || !c.Canary.picks(c.Name, clientNet.IP) {
+		return c.Name
+	}
+	return c.Canary.View
+}
+
+// picks report whether the client IP falls into the canary, the client name salts the hash
+// so the canaries of the several client ACLs pick their own share of the clients
+func (c *Canary) picks(name string, ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write(ip)
+	return int(h.Sum32()%100) < c.Percent
+}
@@ -0,0 +1,112 @@
+package views
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// consulKV represent of a key of the Consul KV recurse response
+type consulKV struct {
+	Key         string `json:"Key"`
+	Value       []byte `json:"Value"`
+	ModifyIndex uint64 `json:"ModifyIndex"`
+}
+
+// parseFromConsul decode the Consul KV source into out, e.g.
+//
+//	consul://127.0.0.1:8500/dns/records      a single key holding all of the entries
+//	consul://127.0.0.1:8500/dns/records/     every key under the prefix holding a single entry
+//
+// the source is only reported as modified when the X-Consul-Index is changed since the last fetch
+func (v *Views) parseFromConsul(src *Source, out interface{}) (bool, error) {
+	u, err := url.Parse(src.Path)
+	if err != nil {
+		return false, err
+	}
+
+	recurse := strings.HasSuffix(u.Path, "/")
+
+	endpoint := url.URL{
+		Scheme: "http",
+		Host:   u.Host,
+		Path:   "/v1/kv/" + strings.TrimPrefix(u.Path, "/"),
+	}
+	if src.TLSConfig != nil {
+		endpoint.Scheme = "https"
+	}
+
+	query := url.Values{}
+	if recurse {
+		query.Set("recurse", "true")
+	} else {
+		query.Set("raw", "true")
+	}
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(v.ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	if src.Token != "" {
+		req.Header.Set("X-Consul-Token", src.Token)
+	}
+	setUserAgent(req, v.HTTPUserAgent)
+
+	client := &http.Client{
+		Timeout:   v.HTTPTimeout,
+		Transport: src.httpTransport(),
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, fmt.Errorf("key is not found on consul: %s", u.Path)
+	default:
+		return false, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if !recurse {
+		if err := yaml.Unmarshal(body, out); err != nil {
+			return false, err
+		}
+	} else {
+		var kvs []consulKV
+		if err := json.Unmarshal(body, &kvs); err != nil {
+			return false, err
+		}
+
+		resetEntries(out)
+		for _, kv := range kvs {
+			// the folder keys hold no value
+			if len(kv.Value) == 0 {
+				continue
+			}
+			if err := appendEntry(out, kv.Value); err != nil {
+				return false, fmt.Errorf("failed to decode key %s: %v", kv.Key, err)
+			}
+		}
+	}
+
+	index := resp.Header.Get("X-Consul-Index")
+	modified := index == "" || index != src.consulIndex
+	src.consulIndex = index
+
+	return modified, nil
+}
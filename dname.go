@@ -0,0 +1,69 @@
+package views
+
+import (
+	"context"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// dname find the DNAME record of the closest owner strictly above qname within the apex,
+// which redirects the whole subtree below its owner as described on RFC 6672
+func (zs Zones) dname(qname, apex string) (Zone, bool) {
+	if apex == "" || qname == apex {
+		return Zone{}, false
+	}
+
+	for off, end := dns.NextLabel(qname, 0); !end; off, end = dns.NextLabel(qname, off) {
+		name := qname[off:]
+		if dnames := zs.Z[name][dns.TypeDNAME]; len(dnames) > 0 {
+			return dnames[0], true
+		}
+		if name == apex {
+			break
+		}
+	}
+
+	return Zone{}, false
+}
+
+// synthesizeDNAME answer the query below the DNAME owner with the DNAME record along with
+// the CNAME synthesized into its target, which is resolved further as the other CNAME targets,
+// the query is answered with YXDOMAIN when the synthesized name would exceed 255 octets
+func (v *Views) synthesizeDNAME(ctx context.Context, state request.Request, snap *snapshot, view string, z Zone) (*dns.Msg, error) {
+	qname, owner, qtype := state.Name(), state.QName(), state.QType()
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+
+	prefix := len(qname) - len(z.Name)
+
+	dname := dns.Copy(z.RR)
+	dname.Header().Name = owner[prefix:]
+	m.Answer = append(m.Answer, dname)
+
+	target := qname[:prefix] + z.Value
+	if _, ok := dns.IsDomainName(target); !ok {
+		m.Rcode = dns.RcodeYXDomain
+		return m, nil
+	}
+
+	m.Answer = append(m.Answer, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: owner, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: z.RR.Header().Ttl},
+		Target: target,
+	})
+
+	if qtype == dns.TypeCNAME {
+		return m, nil
+	}
+
+	rrs, err := v.chase(ctx, state, snap, view, target, qtype)
+	if err != nil {
+		return nil, err
+	}
+	m.Answer = append(m.Answer, rrs...)
+
+	return m, nil
+}
@@ -0,0 +1,79 @@
+package views
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// defaultDNS64Prefix is the well-known NAT64 prefix described on RFC 6052
+const defaultDNS64Prefix = "64:ff9b::/96"
+
+// dns64 synthesize the AAAA records from the A records of the name for the view with DNS64 enabled,
+// it is only called when the name owns no AAAA record, as described on RFC 6147
+func (v *Views) dns64(view string, node map[uint16][]Zone) []Zone {
+	prefix, ok := v.DNS64[view]
+	if !ok {
+		return nil
+	}
+
+	var zs []Zone
+	for _, z := range node[dns.TypeA] {
+		a, ok := z.RR.(*dns.A)
+		if !ok {
+			continue
+		}
+
+		ip := embedIPv4(prefix, a.A.To4())
+		zs = append(zs, Zone{
+			Name:   z.Name,
+			TTL:    z.TTL,
+			Type:   dns.TypeAAAA,
+			Value:  ip.String(),
+			Weight: z.Weight,
+			RR: &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: a.Hdr.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: a.Hdr.Ttl},
+				AAAA: ip,
+			},
+		})
+	}
+
+	return zs
+}
+
+// embedIPv4 embed the IPv4 address into the NAT64 prefix as described on RFC 6052,
+// the bits 64 to 71 (the u-octet) are skipped and left zero
+func embedIPv4(prefix *net.IPNet, ip4 net.IP) net.IP {
+	ones, _ := prefix.Mask.Size()
+
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP.To16())
+
+	for i, j := ones/8, 0; j < net.IPv4len; i++ {
+		if i == 8 {
+			continue
+		}
+		ip[i] = ip4[j]
+		j++
+	}
+
+	return ip
+}
+
+// parseDNS64Prefix parse the NAT64 prefix which must be an IPv6 prefix of the length allowed by RFC 6052
+func parseDNS64Prefix(prefix string) (*net.IPNet, error) {
+	ip, prefixNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() != nil {
+		return nil, fmt.Errorf("dns64 prefix must be an IPv6 prefix: %s", prefix)
+	}
+
+	switch ones, _ := prefixNet.Mask.Size(); ones {
+	case 32, 40, 48, 56, 64, 96:
+		return prefixNet, nil
+	}
+	return nil, fmt.Errorf("dns64 prefix length must be one of 32, 40, 48, 56, 64 or 96: %s", prefix)
+}
@@ -0,0 +1,170 @@
+package views
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/dnssec"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dnssecCacheCapacity is the number of the signatures cached by each signer
+	dnssecCacheCapacity = 10000
+	// dnskeyTTL is the TTL of the DNSKEY records
+	dnskeyTTL = 3600
+)
+
+// signer represent of the DNSSEC keys of a view along with the online signer of its responses
+type signer struct {
+	keys   []*dnssec.DNSKEY
+	dnssec dnssec.Dnssec
+}
+
+// signerOf return the signer of the view, the one given for the view takes precedence
+// over the one of every view, it is nil when the view responses are not signed
+func (v *Views) signerOf(view string) *signer {
+	if s, ok := v.viewSigners[view]; ok {
+		return s
+	}
+	return v.signer
+}
+
+// dnskey return the DNSKEY records of the signer owned by the apex
+func (s *signer) dnskey(apex string) []dns.RR {
+	keys := make([]dns.RR, 0, len(s.keys))
+	for _, k := range s.keys {
+		key := dns.Copy(k.K)
+		key.Header().Name = apex
+		key.Header().Ttl = dnskeyTTL
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// sign add the signatures to the authoritative response of the view, the answers out of the apex
+// (e.g. the target of a CNAME chased on the upstream) are never signed with the keys of the view,
+// the denial of existence is answered with NSEC black lies
+func (s *signer) sign(state request.Request, m *dns.Msg, apex, server string) *dns.Msg {
+	var own, foreign []dns.RR
+	for _, rr := range m.Answer {
+		if dns.IsSubDomain(apex, rr.Header().Name) {
+			own = append(own, rr)
+		} else {
+			foreign = append(foreign, rr)
+		}
+	}
+	m.Answer = own
+
+	signed := s.dnssec.Sign(request.Request{W: state.W, Req: m, Zone: apex}, time.Now().UTC(), server)
+	signed.Answer = append(signed.Answer, foreign...)
+	return signed
+}
+
+// parseDNSSEC parse the dnssec block which keys are used to sign the responses of the given views,
+// or of every view when none is given, e.g.
+//
+//	dnssec dc1 dc2 {
+//	    key file Kexample.internal.+013+45330
+//	}
+func (v *Views) parseDNSSEC(c *caddy.Controller) error {
+	views := c.RemainingArgs()
+
+	if !c.NextArg() || c.Val() != "{" {
+		return c.ArgErr()
+	}
+
+	var keys []*dnssec.DNSKEY
+	for c.Next() {
+		if c.Val() == "}" {
+			if len(keys) == 0 {
+				return fmt.Errorf("dnssec requires at least a key")
+			}
+
+			s := &signer{keys: keys}
+			if len(views) == 0 {
+				v.signer = s
+				return nil
+			}
+			if v.viewSigners == nil {
+				v.viewSigners = make(map[string]*signer)
+			}
+			for _, view := range views {
+				v.viewSigners[view] = s
+			}
+			return nil
+		}
+
+		switch c.Val() {
+		case "key":
+			args := c.RemainingArgs()
+			if len(args) < 2 || args[0] != "file" {
+				return c.ArgErr()
+			}
+			for _, base := range args[1:] {
+				k, err := parseKeyFile(dnsserver.GetConfig(c).Root, base)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, k)
+			}
+		default:
+			return fmt.Errorf("unknown dnssec option: %s", c.Val())
+		}
+	}
+
+	return c.EOFErr()
+}
+
+// parseKeyFile parse the key pair of the base name, with or without the .key/.private extension
+func parseKeyFile(root, base string) (*dnssec.DNSKEY, error) {
+	base = strings.TrimSuffix(strings.TrimSuffix(base, ".key"), ".private")
+	if !filepath.IsAbs(base) && root != "" {
+		base = filepath.Join(root, base)
+	}
+	return dnssec.ParseKeyFile(base+".key", base+".private")
+}
+
+// splitKeys report whether the keys have both the KSK and ZSK,
+// otherwise every key is used to sign every RRset
+func splitKeys(keys []*dnssec.DNSKEY) bool {
+	var ksk, zsk bool
+	for _, k := range keys {
+		if k.K.Flags&dns.SEP == dns.SEP {
+			ksk = true
+		} else if k.K.Flags&dns.ZONE == dns.ZONE {
+			zsk = true
+		}
+	}
+	return ksk && zsk
+}
+
+// setupSigners check that every key is able to sign one of the zones,
+// then create the signer of the keys, it requires the zones to be parsed
+func (v *Views) setupSigners() error {
+	signers := []*signer{v.signer}
+	for _, s := range v.viewSigners {
+		signers = append(signers, s)
+	}
+
+	for _, s := range signers {
+		if s == nil {
+			continue
+		}
+		for _, k := range s.keys {
+			if plugin.Zones(v.Zones).Matches(k.K.Header().Name) == "" {
+				return fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", k.K.Header().Name, k.K.KeyTag())
+			}
+		}
+		s.dnssec = dnssec.New(v.Zones, s.keys, splitKeys(s.keys), nil, cache.New(dnssecCacheCapacity))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package views
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// configVersion is the latest version of the config documents supported by the plugin
+const configVersion = 1
+
+type (
+	// RawClientDocument represent of the clients config document, which is either a list of the clients,
+	// or a mapping of the version along with the clients
+	RawClientDocument struct {
+		Version int            `yaml:"version" json:"version"`
+		Clients []RawClientACL `yaml:"clients" json:"clients"`
+	}
+
+	// RawRecordDocument represent of the records config document, which is either a list of the views,
+	// or a mapping of the version along with the views
+	RawRecordDocument struct {
+		Version int         `yaml:"version" json:"version"`
+		Views   []RawRecord `yaml:"views" json:"views"`
+	}
+
+	// RawConfigDocument represent of the combined config document, which holds both of the clients and the views
+	RawConfigDocument struct {
+		Version int            `yaml:"version" json:"version"`
+		Clients []RawClientACL `yaml:"clients" json:"clients"`
+		Records []RawRecord    `yaml:"records" json:"records"`
+	}
+)
+
+// rawDocument is implemented by the config documents,
+// so the sources storing an entry per key or per file can decode the entries into the document
+type rawDocument interface {
+	entries() interface{}
+	names() []string
+	version() *int
+}
+
+func (d *RawClientDocument) entries() interface{} { return &d.Clients }
+
+func (d *RawClientDocument) names() []string {
+	names := make([]string, len(d.Clients))
+	for i, client := range d.Clients {
+		names[i] = client.Name
+	}
+	return names
+}
+
+func (d *RawClientDocument) version() *int { return &d.Version }
+
+func (d *RawRecordDocument) entries() interface{} { return &d.Views }
+
+func (d *RawRecordDocument) names() []string {
+	names := make([]string, len(d.Views))
+	for i, view := range d.Views {
+		names[i] = view.Name
+	}
+	return names
+}
+
+func (d *RawRecordDocument) version() *int { return &d.Version }
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *RawClientDocument) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if isYAMLList(unmarshal) {
+		return unmarshal(&d.Clients)
+	}
+	type plain RawClientDocument
+	return unmarshal((*plain)(d))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *RawClientDocument) UnmarshalJSON(b []byte) error {
+	if isJSONList(b) {
+		return json.Unmarshal(b, &d.Clients)
+	}
+	type plain RawClientDocument
+	return json.Unmarshal(b, (*plain)(d))
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *RawRecordDocument) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if isYAMLList(unmarshal) {
+		return unmarshal(&d.Views)
+	}
+	type plain RawRecordDocument
+	return unmarshal((*plain)(d))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *RawRecordDocument) UnmarshalJSON(b []byte) error {
+	if isJSONList(b) {
+		return json.Unmarshal(b, &d.Views)
+	}
+	type plain RawRecordDocument
+	return json.Unmarshal(b, (*plain)(d))
+}
+
+func isYAMLList(unmarshal func(interface{}) error) bool {
+	var list []interface{}
+	return unmarshal(&list) == nil
+}
+
+func isJSONList(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte("["))
+}
+
+// checkVersion check the version of the config document loaded from the source,
+// a version newer than the supported one is refused in strict mode and warned otherwise
+func (v *Views) checkVersion(src *Source, version int) error {
+	if version <= configVersion {
+		return nil
+	}
+
+	if v.Strict {
+		return fmt.Errorf("config version %d of %s is newer than the supported version %d", version, src.Path, configVersion)
+	}
+	log.Warningf("config version %d of %s is newer than the supported version %d, it may be mis-parsed", version, src.Path, configVersion)
+	return nil
+}
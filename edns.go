@@ -0,0 +1,196 @@
+package views
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	// clientCookieLen is the length of the client cookie, and the server cookie is 8 to 32 bytes long
+	clientCookieLen    = 8
+	minServerCookieLen = 8
+	maxServerCookieLen = 32
+
+	// serverCookieLen and serverCookieVersion is the server cookie generated by the plugin, which consists of
+	// the version, 3 reserved bytes, the timestamp and the first 8 bytes of HMAC-SHA256 of the client cookie,
+	// the preceding fields and the client IP, as the layout of RFC 9018
+	serverCookieLen     = 16
+	serverCookieVersion = 1
+
+	// cookieSecretLen is the length of the secret of the server cookies
+	cookieSecretLen = 16
+
+	// cookieMaxAge and cookieMaxSkew is how old and how far in the future the timestamp of
+	// the server cookie sent back by the client may be
+	cookieMaxAge  = time.Hour
+	cookieMaxSkew = 5 * time.Minute
+)
+
+// errBadCookie is returned when the DNS cookie of the query is malformed, which is answered with FORMERR
+var errBadCookie = errors.New("malformed DNS cookie")
+
+// parseCookieSecret parse the hex-encoded secret of the server cookies, a random one is generated
+// when it is empty, then the server cookies are no longer valid once the server is restarted
+func parseCookieSecret(secret string) ([]byte, error) {
+	if secret == "" {
+		b := make([]byte, cookieSecretLen)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	b, err := hex.DecodeString(secret)
+	if err != nil || len(b) != cookieSecretLen {
+		return nil, fmt.Errorf("cookie secret must be %d hex-encoded bytes", cookieSecretLen)
+	}
+	return b, nil
+}
+
+// ednsOptions return the EDNS0 options of the query understood by the plugin which are echoed in the response,
+// that is the client subnet option used to match the client with its scope set to the source prefix, and
+// the client cookie along with a fresh server cookie when cookies are enabled
+func (v *Views) ednsOptions(state request.Request, now time.Time) ([]dns.EDNS0, error) {
+	opt := state.Req.IsEdns0()
+	if opt == nil {
+		return nil, nil
+	}
+
+	var options []dns.EDNS0
+	if ecs, _ := v.clientSubnet(state.Req); ecs != nil {
+		echo := *ecs
+		echo.SourceScope = ecs.SourceNetmask
+		options = append(options, &echo)
+	}
+
+	if v.CookieSecret == nil {
+		return options, nil
+	}
+	for _, o := range opt.Option {
+		cookie, ok := o.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+
+		b, err := hex.DecodeString(cookie.Cookie)
+		if n := len(b) - clientCookieLen; err != nil || n != 0 && (n < minServerCookieLen || n > maxServerCookieLen) {
+			return nil, errBadCookie
+		}
+
+		ip := net.ParseIP(state.IP())
+		if len(b) > clientCookieLen && !v.validServerCookie(b[:clientCookieLen], b[clientCookieLen:], ip, now) {
+			log.Debugf("server cookie of %s is not valid, issuing a new one", state.IP())
+		}
+
+		b = append(b[:clientCookieLen:clientCookieLen], v.serverCookie(b[:clientCookieLen], ip, uint32(now.Unix()))...)
+		options = append(options, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(b)})
+		break
+	}
+	return options, nil
+}
+
+// serverCookie return the server cookie of the client cookie and IP issued at the timestamp
+func (v *Views) serverCookie(clientCookie []byte, ip net.IP, timestamp uint32) []byte {
+	b := make([]byte, serverCookieLen)
+	b[0] = serverCookieVersion
+	binary.BigEndian.PutUint32(b[4:8], timestamp)
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	mac := hmac.New(sha256.New, v.CookieSecret)
+	mac.Write(clientCookie)
+	mac.Write(b[:8])
+	mac.Write(ip)
+	copy(b[8:], mac.Sum(nil))
+	return b
+}
+
+// validServerCookie report whether the server cookie is issued by the plugin for the client cookie and IP,
+// and its timestamp is recent enough
+func (v *Views) validServerCookie(clientCookie, cookie []byte, ip net.IP, now time.Time) bool {
+	if len(cookie) != serverCookieLen || cookie[0] != serverCookieVersion {
+		return false
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint32(cookie[4:8])), 0)
+	if issued.Before(now.Add(-cookieMaxAge)) || issued.After(now.Add(cookieMaxSkew)) {
+		return false
+	}
+	return hmac.Equal(cookie, v.serverCookie(clientCookie, ip, uint32(issued.Unix())))
+}
+
+// ednsWriter add the EDNS0 options into the OPT RR of the responses, the OPT RR of the response
+// without any is built aside from the one of the request, which is never modified, and SizeAndDo
+// then sets its UDP size and DO bit as of the request as the scrub writer of the server does
+type ednsWriter struct {
+	dns.ResponseWriter
+	state   request.Request
+	options []dns.EDNS0
+}
+
+// WriteMsg implements the dns.ResponseWriter interface,
+// the options replace the ones of the same code which are already in the response
+func (w *ednsWriter) WriteMsg(m *dns.Msg) error {
+	req := w.state.Req.IsEdns0()
+	if req == nil {
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		// the supported options of the request are echoed as SizeAndDo does with the OPT RR of the request
+		opt = &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+		for _, o := range req.Option {
+			if supportedOption(o.Option()) {
+				opt.Option = append(opt.Option, o)
+			}
+		}
+		m.Extra = append(m.Extra, opt)
+	}
+	w.state.SizeAndDo(m)
+
+	codes := make(map[uint16]bool, len(w.options))
+	for _, o := range w.options {
+		codes[o.Option()] = true
+	}
+
+	options := make([]dns.EDNS0, 0, len(opt.Option)+len(w.options))
+	for _, o := range opt.Option {
+		if !codes[o.Option()] {
+			options = append(options, o)
+		}
+	}
+	opt.Option = append(options, w.options...)
+
+	// the TSIG RR must stay the last one of the additional section, after the OPT RR appended above
+	for i, rr := range m.Extra {
+		if t, ok := rr.(*dns.TSIG); ok && i < len(m.Extra)-1 {
+			m.Extra = append(append(m.Extra[:i:i], m.Extra[i+1:]...), t)
+			break
+		}
+	}
+
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// supportedOption report whether the EDNS0 option of the request is echoed in the response,
+// which is the same as the options kept by SizeAndDo
+func supportedOption(code uint16) bool {
+	switch code {
+	case dns.EDNS0NSID, dns.EDNS0EXPIRE, dns.EDNS0COOKIE, dns.EDNS0TCPKEEPALIVE, dns.EDNS0PADDING:
+		return true
+	}
+	return edns.SupportedOption(code)
+}
@@ -0,0 +1,66 @@
+package views
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+)
+
+// NewViews create the plugin serving the given clients and views within the origins, e.g. example.internal,
+// for the programs embedding CoreDNS which feed the config by themselves rather than from the sources,
+// the clients and views are built from its raw specification by NewClientACLs and NewClientZones,
+// and they are replaced afterward by Update
+func NewViews(origins []string, clientACLs []*ClientACL, clientZones map[string]Zones) (*Views, error) {
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("no origin is given")
+	}
+
+	v := &Views{
+		ReloadInterval: defaultReloadInterval,
+		HTTPTimeout:    defaultHTTPTimeout,
+		Upstream:       upstream.New(),
+		Zones:          make([]string, len(origins)),
+		trigger:        make(chan chan error),
+	}
+	v.ctx, v.cancel = context.WithCancel(context.Background())
+
+	for i, origin := range origins {
+		v.Zones[i] = plugin.Host(origin).Normalize()
+	}
+
+	if err := v.Update(clientACLs, clientZones); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Update replace the clients and views which are served, the previous ones are kept when those are invalid,
+// the view serials are tracked as of the reloads, and the given clients and views must not be modified afterward
+func (v *Views) Update(clientACLs []*ClientACL, clientZones map[string]Zones) error {
+	if err := validateConfig(clientACLs, clientZones, true, true); err != nil {
+		return fmt.Errorf("invalid config, keeping the previous one: %v", err)
+	}
+
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+
+	prev := v.current()
+
+	zones := make(map[string]Zones, len(clientZones))
+	for name, z := range clientZones {
+		zones[name] = z
+	}
+	trackSerials(prev.clientZones, zones)
+
+	next := prev.clone()
+	next.clientACLs = clientACLs
+	next.clientZones = zones
+	next.clientsLoaded, next.recordsLoaded = true, true
+	next.warmup()
+	v.publish(next)
+
+	v.notifyChanges(prev.clientACLs, prev.clientZones, clientACLs, zones)
+	return nil
+}
@@ -0,0 +1,119 @@
+package views
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	etcdcv3 "go.etcd.io/etcd/clientv3"
+)
+
+// etcdSource represent of the etcd client of the source along with the state of the last fetch
+type etcdSource struct {
+	client *etcdcv3.Client
+	prefix string
+
+	// revision and count is the latest modified revision and the number of the keys
+	// under the prefix on the last fetch, which tell whether the source has been modified
+	revision int64
+	count    int
+}
+
+// parseFromEtcd decode every key under the prefix of the etcd source into out,
+// each key holding a single client or view in JSON or YAML, ordered by its key
+func (v *Views) parseFromEtcd(src *Source, out interface{}) (bool, error) {
+	if src.etcd == nil {
+		es, err := newEtcdSource(src)
+		if err != nil {
+			return false, err
+		}
+		src.etcd = es
+	}
+
+	ctx, cancel := context.WithTimeout(v.ctx, v.HTTPTimeout)
+	defer cancel()
+
+	resp, err := src.etcd.client.Get(ctx, src.etcd.prefix,
+		etcdcv3.WithPrefix(),
+		etcdcv3.WithSort(etcdcv3.SortByKey, etcdcv3.SortAscend),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	resetEntries(out)
+
+	var revision int64
+	for _, kv := range resp.Kvs {
+		if kv.ModRevision > revision {
+			revision = kv.ModRevision
+		}
+
+		if err := appendEntry(out, kv.Value); err != nil {
+			return false, fmt.Errorf("failed to decode key %s: %v", kv.Key, err)
+		}
+	}
+
+	modified := revision != src.etcd.revision || len(resp.Kvs) != src.etcd.count
+	src.etcd.revision, src.etcd.count = revision, len(resp.Kvs)
+
+	return modified, nil
+}
+
+// newEtcdSource create the etcd client of the source from its path, e.g.
+// etcd://10.0.0.1:2379,10.0.0.2:2379/dns/records
+func newEtcdSource(src *Source) (*etcdSource, error) {
+	u, err := url.Parse(src.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http://"
+	if src.TLSConfig != nil {
+		scheme = "https://"
+	}
+
+	var endpoints []string
+	for _, host := range strings.Split(u.Host, ",") {
+		if host != "" {
+			endpoints = append(endpoints, scheme+host)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no etcd endpoint is given: %s", src.Path)
+	}
+
+	prefix := u.Path
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	cfg := etcdcv3.Config{
+		Endpoints: endpoints,
+		TLS:       src.TLSConfig,
+	}
+	if src.Username != "" && src.Password != "" {
+		cfg.Username = src.Username
+		cfg.Password = src.Password
+	}
+
+	client, err := etcdcv3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcdSource{client: client, prefix: prefix}, nil
+}
+
+// closeSources close the connection of the sources which hold one
+func (v *Views) closeSources() {
+	for _, src := range v.sources() {
+		if src.etcd != nil {
+			if err := src.etcd.client.Close(); err != nil {
+				log.Warningf("failed to close etcd client of %s: %v", src.Path, err)
+			}
+			src.etcd = nil
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package views
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// forwardTimeout is the timeout of every attempt of the query forwarded to the upstream of a view
+const forwardTimeout = 2 * time.Second
+
+// forward send the query to the upstreams of the view in order and return the first reply,
+// the query is sent again over TCP when the UDP reply is truncated
+func forward(ctx context.Context, state request.Request, upstreams []string) (*dns.Msg, error) {
+	var lastErr error
+	for _, addr := range upstreams {
+		c := &dns.Client{Net: state.Proto(), Timeout: forwardTimeout}
+
+		reply, _, err := c.ExchangeContext(ctx, state.Req, addr)
+		if err == nil && reply.Truncated && c.Net == "udp" {
+			c.Net = "tcp"
+			reply, _, err = c.ExchangeContext(ctx, state.Req, addr)
+		}
+		if err != nil {
+			lastErr = err
+			log.Warningf("failed to forward %s to upstream %s: %v", state.QName(), addr, err)
+			continue
+		}
+
+		return reply, nil
+	}
+
+	return nil, fmt.Errorf("no upstream answered %s: %v", state.QName(), lastErr)
+}
@@ -0,0 +1,71 @@
+package views
+
+import (
+	"fmt"
+	"time"
+)
+
+// sourceFreshness represent of the last successful load of a source served by the admin endpoint
+type sourceFreshness struct {
+	Kind     string     `json:"kind"`
+	Path     string     `json:"path"`
+	LoadedAt *time.Time `json:"loaded_at"`
+	// Age is the number of seconds since the last successful load, it is nil when the source is never loaded
+	Age *float64 `json:"age"`
+}
+
+// freshness return the last successful load of every source of the views
+func (s *snapshot) freshness(v *Views, now time.Time) []sourceFreshness {
+	srcs := make([]sourceFreshness, 0, len(v.Clients)+len(v.Records)+len(v.Configs))
+	add := func(kind string, src *Source) {
+		f := sourceFreshness{Kind: kind, Path: src.Path}
+		if loadedAt, ok := s.loadedAt[src]; ok {
+			age := now.Sub(loadedAt).Seconds()
+			f.LoadedAt, f.Age = &loadedAt, &age
+		}
+		srcs = append(srcs, f)
+	}
+
+	for _, src := range v.Clients {
+		add("client", src)
+	}
+	for _, src := range v.Records {
+		add("record", src)
+	}
+	for _, src := range v.Configs {
+		add("config", src)
+	}
+	return srcs
+}
+
+// logFreshness log the size of the loaded config along with the age of its stalest source
+func (v *Views) logFreshness() {
+	snap := v.current()
+
+	records := 0
+	for _, zones := range snap.clientZones {
+		for _, node := range zones.Z {
+			for _, zs := range node {
+				records += len(zs)
+			}
+		}
+	}
+
+	age := "unknown"
+	var oldest time.Time
+	for i, src := range v.sources() {
+		loadedAt, ok := snap.loadedAt[src]
+		if !ok {
+			oldest = time.Time{}
+			break
+		}
+		if i == 0 || loadedAt.Before(oldest) {
+			oldest = loadedAt
+		}
+	}
+	if !oldest.IsZero() {
+		age = fmt.Sprintf("%ds", int64(time.Since(oldest).Seconds()))
+	}
+
+	log.Infof("loaded %d clients, %d records, age %s", len(snap.clientACLs), records, age)
+}
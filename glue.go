@@ -0,0 +1,60 @@
+package views
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// glue append the addresses of the targets of the answer and authority records which are owned by the view
+// into the additional section, so the client needs no follow-up query for them, the targets which are
+// already answered (e.g. by following the CNAME chain) are skipped and each target is added once
+func (v *Views) glue(snap *snapshot, view string, qtype uint16, m *dns.Msg) {
+	seen := make(map[string]bool)
+	for _, rr := range m.Answer {
+		seen[strings.ToLower(rr.Header().Name)] = true
+	}
+
+	for _, rrs := range [][]dns.RR{m.Answer, m.Ns} {
+		for _, rr := range rrs {
+			target := glueTarget(rr, qtype)
+			if target == "" || seen[target] || plugin.Zones(v.Zones).Matches(target) == "" {
+				continue
+			}
+			seen[target] = true
+
+			zones := snap.clientZones[ownerView(snap.clientZones, view, target)]
+			node, ok := zones.lookup(target)
+			if !ok {
+				continue
+			}
+			for _, rrtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				for _, z := range pickWeighted(node[rrtype]) {
+					glue := dns.Copy(z.RR)
+					glue.Header().Name = target
+					m.Extra = append(m.Extra, glue)
+				}
+			}
+		}
+	}
+}
+
+// glueTarget return the target name of the record which addresses are worth to be added,
+// the CNAME target is only added to the CNAME query since the other queries follow the chain
+func glueTarget(rr dns.RR, qtype uint16) string {
+	var target string
+	switch rr := rr.(type) {
+	case *dns.NS:
+		target = rr.Ns
+	case *dns.MX:
+		target = rr.Mx
+	case *dns.SRV:
+		target = rr.Target
+	case *dns.CNAME:
+		if qtype == dns.TypeCNAME {
+			target = rr.Target
+		}
+	}
+	return strings.ToLower(target)
+}
@@ -3,10 +3,14 @@ module github.com/ardikabs/views
 go 1.14
 
 require (
+	github.com/aws/aws-sdk-go v1.35.9
 	github.com/coredns/caddy v1.1.0
 	github.com/coredns/coredns v1.8.0
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/miekg/dns v1.1.35
+	github.com/prometheus/client_golang v1.8.0
 	github.com/prometheus/common v0.14.0
 	github.com/tmc/grpc-websocket-proxy v0.0.0-20190109142713-0ad062ec5ee5 // indirect
+	go.etcd.io/etcd v0.5.0-alpha.5.0.20200306183522-221f0cc107cb
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,86 @@
+package views
+
+import (
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	// localTTL is the TTL of the loopback answers, which never change
+	localTTL = 604800
+
+	// localhost is the name of the loopback addresses, and localPTR4 and localPTR6 is their reverse names
+	localhost = "localhost."
+	localPTR4 = "1.0.0.127.in-addr.arpa."
+	localPTR6 = "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa."
+)
+
+// localZones is the zones of the loopback and special addresses answered by the local option regardless of
+// the view, as the local plugin of CoreDNS does, so those lookups are never sent to the upstream of a view
+var localZones = []string{
+	localhost,
+	"0.in-addr.arpa.",
+	"127.in-addr.arpa.",
+	"255.in-addr.arpa.",
+	"0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.",
+	localPTR6,
+}
+
+// local answer the query when its name is within the local zones, it reports whether the query is answered,
+// only the loopback names have the answers and any other name below the zones does not exist
+func (v *Views) local(w dns.ResponseWriter, state request.Request) (int, bool) {
+	qname := state.Name()
+	apex := plugin.Zones(localZones).Matches(qname)
+	if apex == "" {
+		return 0, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+
+	hdr := dns.RR_Header{Name: state.QName(), Rrtype: state.QType(), Class: dns.ClassINET, Ttl: localTTL}
+	switch qname {
+	case localhost:
+		switch state.QType() {
+		case dns.TypeA:
+			m.Answer = []dns.RR{&dns.A{Hdr: hdr, A: net.IPv4(127, 0, 0, 1)}}
+		case dns.TypeAAAA:
+			m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: net.IPv6loopback}}
+		}
+	case localPTR4, localPTR6:
+		if state.QType() == dns.TypePTR {
+			m.Answer = []dns.RR{&dns.PTR{Hdr: hdr, Ptr: localhost}}
+		}
+	default:
+		if qname != apex {
+			m.Rcode = dns.RcodeNameError
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{localSOA(apex)}
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Error(err)
+	}
+	return m.Rcode, true
+}
+
+// localSOA return the SOA of the local zone
+func localSOA(apex string) dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: apex, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: localTTL},
+		Ns:      localhost,
+		Mbox:    "root." + localhost,
+		Serial:  1,
+		Refresh: localTTL,
+		Retry:   86400,
+		Expire:  2419200,
+		Minttl:  localTTL,
+	}
+}
@@ -0,0 +1,86 @@
+package views
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// capAnswers keep at most the maximum answers of every name in the reply, the extra records are dropped
+// on purpose so the TC bit is left unset, and nothing is dropped when the maximum answers is zero
+func (v *Views) capAnswers(m *dns.Msg) {
+	if v.MaxAnswers <= 0 {
+		return
+	}
+
+	count := make(map[string]int)
+	answers := m.Answer[:0]
+	for _, rr := range m.Answer {
+		name := strings.ToLower(rr.Header().Name)
+		if count[name] >= v.MaxAnswers {
+			continue
+		}
+		count[name]++
+		answers = append(answers, rr)
+	}
+	m.Answer = answers
+}
+
+// capRecords keep at most the maximum records of every view including the inherited ones, the records
+// of the names coming last are dropped with a warning, and nothing is dropped when the maximum records is zero
+func capRecords(clientZones map[string]Zones, max int) {
+	if max <= 0 {
+		return
+	}
+
+	for view, zones := range clientZones {
+		total := 0
+		for _, node := range zones.Z {
+			for _, zs := range node {
+				total += len(zs)
+			}
+		}
+		if total <= max {
+			continue
+		}
+
+		log.Warningf("(%s) %d records exceed the maximum of %d records, dropping the rest", view, total, max)
+		droppedCount.WithLabelValues(droppedMaxRecords).Add(float64(total - max))
+
+		// the zones are rebuilt as the nodes may be shared with the views inheriting them
+		names := make([]string, 0, len(zones.Names))
+		z := make(map[string]map[uint16][]Zone, len(zones.Z))
+		left := max
+		for _, name := range zones.Names {
+			if left == 0 {
+				break
+			}
+
+			node := zones.Z[name]
+			qtypes := make([]int, 0, len(node))
+			for qtype := range node {
+				qtypes = append(qtypes, int(qtype))
+			}
+			sort.Ints(qtypes)
+
+			kept := make(map[uint16][]Zone, len(node))
+			for _, qtype := range qtypes {
+				zs := node[uint16(qtype)]
+				if len(zs) > left {
+					zs = zs[:left]
+				}
+				if len(zs) == 0 {
+					continue
+				}
+				kept[uint16(qtype)] = zs
+				left -= len(zs)
+			}
+			names = append(names, name)
+			z[name] = kept
+		}
+
+		zones.Names, zones.Z = names, z
+		clientZones[view] = zones
+	}
+}
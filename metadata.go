@@ -0,0 +1,32 @@
+package views
+
+import (
+	"context"
+	"net"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+)
+
+// Metadata implements the metadata.Provider interface,
+// it exports the name of the view matched to the client as {/views/name}
+func (v *Views) Metadata(ctx context.Context, state request.Request) context.Context {
+	metadata.SetValueFunc(ctx, v.Name()+"/name", func() string {
+		return v.viewOf(v.clientNet(state), serverIP(state), state.Name())
+	})
+	return ctx
+}
+
+// viewOf return the name of the view that the client network and the query name are matched to,
+// which is the fallback view when none is matched
+func (v *Views) viewOf(clientNet *net.IPNet, serverIP net.IP, qname string) string {
+	snap := v.current()
+	client, _ := matchClient(snap.clientACLs, clientNet, serverIP)
+	if view, _ := v.nameView(snap, qname, client != nil); view != "" {
+		return view
+	}
+	if client != nil {
+		return client.view(clientNet)
+	}
+	return v.Fallback
+}
@@ -0,0 +1,129 @@
+package views
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// requestCount is counter of requests served by views, partitioned by the matched view (empty when none is matched), query type and response code.
+	requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "requests_total",
+		Help:      "Counter of requests served by views.",
+	}, []string{"server", "view", "type", "rcode"})
+	// unmatchedCount is counter of requests which client is not matched with any view.
+	unmatchedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "unmatched_requests_total",
+		Help:      "Counter of requests which client is not matched with any view.",
+	}, []string{"server"})
+	// blockedCount is counter of requests which are refused by the allow and deny lists before matching any view.
+	blockedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "blocked_requests_total",
+		Help:      "Counter of requests which are refused by the allow and deny lists.",
+	}, []string{"server"})
+	// rateLimitedCount is counter of requests which are refused by the rate limit, partitioned by the matched view.
+	rateLimitedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "rate_limited_requests_total",
+		Help:      "Counter of requests which are refused by the rate limit.",
+	}, []string{"server", "view"})
+	// deniedCount is counter of requests which are refused as their query type is denied for the view.
+	deniedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "denied_requests_total",
+		Help:      "Counter of requests which are refused as their query type is denied for the view.",
+	}, []string{"server", "view", "type"})
+	// reloadDuration is histogram of the time taken to reload the config.
+	reloadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "reload_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time (in seconds) each config reload took.",
+	})
+	// reloadCount is counter of config reloads, partitioned by the result.
+	reloadCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "reload_total",
+		Help:      "Counter of config reloads by the result.",
+	}, []string{"result"})
+	// droppedCount is counter of the config entries which are skipped on load, partitioned by the reason.
+	droppedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "config_dropped_total",
+		Help:      "Counter of the config entries which are skipped on load by the reason.",
+	}, []string{"reason"})
+	// lastReloadTimestamp is the timestamp of the last successful config reload.
+	lastReloadTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "config_last_reload_timestamp_seconds",
+		Help:      "The timestamp of the last successful config reload.",
+	})
+	// servingStale is whether the previous config is being served as the last config reload is failed.
+	servingStale = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "serving_stale",
+		Help:      "Whether the previous config is being served as the last config reload is failed.",
+	})
+	// reloadFailures is the number of the consecutive failed config reloads, it is reset on a successful reload.
+	reloadFailures = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "views",
+		Name:      "reload_consecutive_failures",
+		Help:      "The number of the consecutive failed config reloads since the last successful one.",
+	})
+)
+
+const (
+	// droppedBadCIDR is the reason of the dropped client prefix which is not a valid CIDR
+	droppedBadCIDR = "bad_cidr"
+	// droppedBadType is the reason of the dropped record which type is not supported
+	droppedBadType = "bad_type"
+	// droppedBadValue is the reason of the dropped record which name or value is not valid
+	droppedBadValue = "bad_value"
+	// droppedMaxRecords is the reason of the dropped record which exceeds the maximum records of its view
+	droppedMaxRecords = "max_records"
+)
+
+// monitorType is the query types which are reported as is, any other type is reported as "other"
+// to keep the cardinality of the type label bounded
+var monitorType = map[uint16]struct{}{
+	dns.TypeA:     {},
+	dns.TypeAAAA:  {},
+	dns.TypeCNAME: {},
+	dns.TypeCAA:   {},
+	dns.TypeDNAME: {},
+	dns.TypeMX:    {},
+	dns.TypeNAPTR: {},
+	dns.TypeNS:    {},
+	dns.TypePTR:   {},
+	dns.TypeSOA:   {},
+	dns.TypeSRV:   {},
+	dns.TypeTXT:   {},
+	dns.TypeIXFR:  {},
+	dns.TypeAXFR:  {},
+	dns.TypeANY:   {},
+}
+
+// qTypeLabel return the type label of the query type
+func qTypeLabel(qtype uint16) string {
+	if _, known := monitorType[qtype]; known {
+		return dns.Type(qtype).String()
+	}
+	return "other"
+}
@@ -0,0 +1,133 @@
+package views
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/rcode"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// notifyPort is the port of the secondary when none is given
+	notifyPort = "53"
+	// notifyAttempts is the number of attempts to send the NOTIFY until it is accepted
+	notifyAttempts = 3
+	// notifyTimeout is the timeout of each attempt to send the NOTIFY
+	notifyTimeout = 2 * time.Second
+)
+
+// notification represent of the NOTIFY of a zone sent to a secondary
+type notification struct {
+	view string
+	addr string
+	soa  *dns.SOA
+}
+
+// notifyChanges send the NOTIFY to the secondaries which view is changed by the reload, the view of
+// each secondary is matched as of its query, so the secondary is notified when its view SOA serial
+// is changed or when it is matched to another view, including the first load of the views,
+// the notifications are sent in the background
+func (v *Views) notifyChanges(prevACLs []*ClientACL, prevZones map[string]Zones, clientACLs []*ClientACL, clientZones map[string]Zones) {
+	if len(v.NotifyTo) == 0 {
+		return
+	}
+
+	var notifications []notification
+	for _, addr := range v.NotifyTo {
+		host, _, _ := net.SplitHostPort(addr)
+		clientNet := hostNet(net.ParseIP(host))
+
+		view := v.matchView(clientACLs, clientNet)
+		zones, ok := clientZones[view]
+		if !ok {
+			continue
+		}
+		prevView := v.matchView(prevACLs, clientNet)
+		prev, hasPrev := prevZones[prevView]
+
+		for _, apex := range v.Zones {
+			soa := zones.soa(apex)
+			if hasPrev && prevView == view && prev.soa(apex).Serial == soa.Serial {
+				continue
+			}
+			notifications = append(notifications, notification{view: view, addr: addr, soa: soa})
+		}
+	}
+
+	if len(notifications) == 0 {
+		return
+	}
+
+	go func() {
+		for _, n := range notifications {
+			if v.ctx.Err() != nil {
+				return
+			}
+			if err := v.sendNotify(n); err != nil {
+				log.Warningf("(%s) %s", n.view, err)
+				continue
+			}
+			log.Infof("(%s) sent notify of zone %q to %s for %d SOA serial", n.view, n.soa.Hdr.Name, n.addr, n.soa.Serial)
+		}
+	}()
+}
+
+// matchView return the view of the client network as of the given client ACLs, as of viewOf,
+// the local address of the secondary is unknown so the clients with server prefixes are never matched
+func (v *Views) matchView(clientACLs []*ClientACL, clientNet *net.IPNet) string {
+	if client, _ := matchClient(clientACLs, clientNet, nil); client != nil {
+		return client.view(clientNet)
+	}
+	return v.Fallback
+}
+
+// sendNotify send the NOTIFY along with the SOA of the zone as described on RFC 1996,
+// it is retried until the secondary accepts it or the attempts are exhausted
+func (v *Views) sendNotify(n notification) error {
+	m := new(dns.Msg)
+	m.SetNotify(n.soa.Hdr.Name)
+	m.Answer = []dns.RR{n.soa}
+
+	c := &dns.Client{Timeout: notifyTimeout}
+
+	var (
+		err  error
+		code = dns.RcodeServerFailure
+	)
+	for i := 0; i < notifyAttempts; i++ {
+		var ret *dns.Msg
+		ret, _, err = c.ExchangeContext(v.ctx, m, n.addr)
+		if err != nil {
+			continue
+		}
+		code = ret.Rcode
+		if code == dns.RcodeSuccess {
+			return nil
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("notify of zone %q is not accepted by %s: %v", n.soa.Hdr.Name, n.addr, err)
+	}
+	return fmt.Errorf("notify of zone %q is not accepted by %s: rcode was %s", n.soa.Hdr.Name, n.addr, rcode.ToString(code))
+}
+
+// parseNotifyTo parse the secondaries to be notified, which is an IP address with an optional port
+func parseNotifyTo(args []string) ([]string, error) {
+	var addrs []string
+	for _, arg := range args {
+		host, port, err := net.SplitHostPort(arg)
+		if err != nil {
+			host, port = arg, notifyPort
+		}
+		if net.ParseIP(host) == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: arg}
+		}
+		addrs = append(addrs, net.JoinHostPort(host, port))
+	}
+
+	return addrs, nil
+}
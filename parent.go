@@ -0,0 +1,43 @@
+package views
+
+// maxParentChain is the maximum number of the parent views walked up from a view
+const maxParentChain = 8
+
+// parentChain return the views walked from the view up its parents, it ends at the view without parent,
+// at the first view which is revisited that is reported as a cycle, or once it exceeds maxParentChain
+func parentChain(clientZones map[string]Zones, view string) ([]string, bool) {
+	chain := []string{view}
+	seen := map[string]bool{view: true}
+
+	for len(chain) <= maxParentChain {
+		parent := clientZones[chain[len(chain)-1]].Parent
+		if parent == "" {
+			break
+		}
+
+		chain = append(chain, parent)
+		if seen[parent] {
+			return chain, true
+		}
+		seen[parent] = true
+	}
+
+	return chain, false
+}
+
+// ownerView return the view which answers the name, which is the view itself when it has the name,
+// otherwise the closest of its parents having the name, or still the view itself when none of them has
+func ownerView(clientZones map[string]Zones, view, qname string) string {
+	if clientZones[view].Parent == "" {
+		return view
+	}
+
+	chain, _ := parentChain(clientZones, view)
+	for _, name := range chain {
+		zones := clientZones[name]
+		if _, ok := zones.lookup(qname); ok || zones.exists(qname) {
+			return name
+		}
+	}
+	return view
+}
@@ -0,0 +1,77 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+const (
+	// NamePrecedenceClient represent of the precedence matching the query name only when no client is matched
+	NamePrecedenceClient = "client"
+	// NamePrecedenceName represent of the precedence matching the query name before the client
+	NamePrecedenceName = "name"
+)
+
+// parseMatchNames parse the name patterns of the view, either the exact name, e.g. app.example.com,
+// or the wildcard matching every name below its base, e.g. *.dev.example.com, it returns the valid
+// patterns along with the error of the invalid ones
+func parseMatchNames(patterns []string) ([]string, error) {
+	var (
+		names   []string
+		invalid []string
+	)
+	for _, pattern := range patterns {
+		name := plugin.Host(pattern).Normalize()
+		if strings.Contains(strings.TrimPrefix(name, "*."), "*") || name == "*." {
+			invalid = append(invalid, pattern)
+			continue
+		}
+		names = append(names, name)
+	}
+
+	if len(invalid) > 0 {
+		return names, fmt.Errorf("invalid name patterns: %s", strings.Join(invalid, ", "))
+	}
+	return names, nil
+}
+
+// matchNamePattern report whether the query name is matched to the pattern along with its specificity,
+// the longer base is more specific and the exact name is more specific than the wildcard of the same base
+func matchNamePattern(pattern, qname string) (int, bool) {
+	if base := strings.TrimPrefix(pattern, "*."); base != pattern {
+		if qname != base && dns.IsSubDomain(base, qname) {
+			return 2 * dns.CountLabel(base), true
+		}
+		return 0, false
+	}
+	if strings.EqualFold(pattern, qname) {
+		return 2*dns.CountLabel(pattern) + 1, true
+	}
+	return 0, false
+}
+
+// matchName return the view which name patterns match the query name along with the pattern,
+// the most specific pattern wins and ties are broken by the view name as the views are ordered by their name
+func matchName(clientZones map[string]Zones, views []string, qname string) (view, pattern string) {
+	best := -1
+	for _, name := range views {
+		for _, p := range clientZones[name].MatchNames {
+			if score, ok := matchNamePattern(p, qname); ok && score > best {
+				view, pattern, best = name, p, score
+			}
+		}
+	}
+	return view, pattern
+}
+
+// nameView return the view matched to the query name as of the name precedence,
+// the query name is only matched when no client is matched unless the name takes precedence
+func (v *Views) nameView(snap *snapshot, qname string, clientMatched bool) (view, pattern string) {
+	if clientMatched && v.NamePrecedence != NamePrecedenceName {
+		return "", ""
+	}
+	return matchName(snap.clientZones, snap.nameViews, qname)
+}
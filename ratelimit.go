@@ -0,0 +1,75 @@
+package views
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitIdle is the time after which a bucket without any query is removed,
+// it is also the interval between the sweeps of the idle buckets
+const rateLimitIdle = time.Minute
+
+// RateLimit represent of the rate limit of the queries of a view
+type RateLimit struct {
+	QPS   int
+	Burst int
+}
+
+// rateLimiter represent of the token buckets of the rate limit, keyed by the view
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket represent of a token bucket which is refilled by the QPS of the rate limit
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimit return the rate limit of the view, the one given for the view takes precedence
+// over the one of the plugin, it reports false when the view is not rate limited
+func (v *Views) rateLimit(view string) (RateLimit, bool) {
+	if limit, ok := v.ViewRateLimits[view]; ok {
+		return limit, true
+	}
+	return v.RateLimit, v.RateLimit.QPS > 0
+}
+
+// allow take a token from the bucket of the key and report whether the query is allowed
+func (l *rateLimiter) allow(key string, limit RateLimit, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+
+	if now.Sub(l.lastSweep) >= rateLimitIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= rateLimitIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * float64(limit.QPS)
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,9 @@
+package views
+
+// Ready implements the ready.Readiness interface, it reports ready once both
+// clients and records have been successfully loaded at least once,
+// so the server is not marked ready while every view is still empty
+func (v *Views) Ready() bool {
+	snap := v.current()
+	return snap.clientsLoaded && snap.recordsLoaded
+}
@@ -0,0 +1,81 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// AnswerRewriter represent of the post-processing of the replies of a view, e.g. rewriting the target names,
+// it is called once the reply is assembled and before its TTL is clamped and it is signed,
+// so the rewriter may modify the reply in place but must be safe to be called concurrently
+type AnswerRewriter interface {
+	RewriteAnswer(state request.Request, view string, m *dns.Msg)
+}
+
+// AddRewriter register the rewriter of the replies of the view, the rewriters of a view are called
+// in the registration order, it is meant for the programs embedding the plugin and must be done
+// before the plugin serves any query
+func (v *Views) AddRewriter(view string, rw AnswerRewriter) {
+	if v.Rewriters == nil {
+		v.Rewriters = make(map[string][]AnswerRewriter)
+	}
+	v.Rewriters[view] = append(v.Rewriters[view], rw)
+}
+
+// rewrite pass the reply through the rewriters of the view
+func (v *Views) rewrite(state request.Request, view string, m *dns.Msg) {
+	for _, rw := range v.Rewriters[view] {
+		rw.RewriteAnswer(state, view, m)
+	}
+}
+
+// targetRewriter rewrite the target names of the answers under the domain into the replacement, e.g.
+//
+//	rewrite dc1 legacy.example.internal. dc1.example.internal.
+//
+// so the CNAME target app.legacy.example.internal. is answered as app.dc1.example.internal.,
+// the owner names are kept as they are the names asked by the client
+type targetRewriter struct {
+	from string
+	to   string
+}
+
+// newTargetRewriter create the built-in rewriter of the rewrite directive
+func newTargetRewriter(from, to string) (*targetRewriter, error) {
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("both domain and replacement are required")
+	}
+	return &targetRewriter{from: plugin.Host(from).Normalize(), to: plugin.Host(to).Normalize()}, nil
+}
+
+// RewriteAnswer implements the AnswerRewriter interface
+func (t *targetRewriter) RewriteAnswer(state request.Request, view string, m *dns.Msg) {
+	for _, rr := range m.Answer {
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			rr.Target = t.name(rr.Target)
+		case *dns.DNAME:
+			rr.Target = t.name(rr.Target)
+		case *dns.MX:
+			rr.Mx = t.name(rr.Mx)
+		case *dns.SRV:
+			rr.Target = t.name(rr.Target)
+		case *dns.NS:
+			rr.Ns = t.name(rr.Ns)
+		case *dns.PTR:
+			rr.Ptr = t.name(rr.Ptr)
+		}
+	}
+}
+
+// name return the name with its domain replaced when it is within the domain
+func (t *targetRewriter) name(name string) string {
+	if !dns.IsSubDomain(t.from, name) {
+		return name
+	}
+	return strings.TrimSuffix(strings.ToLower(name), t.from) + t.to
+}
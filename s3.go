@@ -0,0 +1,146 @@
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gopkg.in/yaml.v2"
+)
+
+// s3Source represent of the S3 client of the source along with the object it holds
+type s3Source struct {
+	client *s3.S3
+	bucket string
+	key    string
+}
+
+// parseFromS3 decode the object of the S3 source into out, as JSON or YAML by the suffix of its key,
+// the object is only downloaded once its ETag is changed since the last fetch
+func (v *Views) parseFromS3(src *Source, out interface{}) (bool, error) {
+	if src.s3 == nil {
+		ss, err := newS3Source(src)
+		if err != nil {
+			return false, err
+		}
+		src.s3 = ss
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(src.s3.bucket),
+		Key:    aws.String(src.s3.key),
+	}
+	if src.cache != nil && src.cache.ETag != "" {
+		input.IfNoneMatch = aws.String(src.cache.ETag)
+	}
+
+	ctx, cancel := context.WithTimeout(v.ctx, v.HTTPTimeout)
+	defer cancel()
+
+	var (
+		body     []byte
+		modified bool
+	)
+	resp, err := src.s3.client.GetObjectWithContext(ctx, input)
+	switch {
+	case err == nil:
+		defer resp.Body.Close()
+		if body, err = ioutil.ReadAll(resp.Body); err != nil {
+			return false, err
+		}
+		modified = true
+	case isNotModified(err) && src.cache != nil:
+		body = src.cache.Body
+	default:
+		return false, err
+	}
+
+	if strings.HasSuffix(src.s3.key, ".json") {
+		err = json.Unmarshal(body, out)
+	} else {
+		err = yaml.Unmarshal(body, out)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if modified {
+		src.cache = &httpCache{ETag: aws.StringValue(resp.ETag), Body: body}
+	}
+	return modified, nil
+}
+
+// isNotModified report whether the S3 request is failed as the object is not modified
+func isNotModified(err error) bool {
+	reqErr, ok := err.(awserr.RequestFailure)
+	return ok && reqErr.StatusCode() == http.StatusNotModified
+}
+
+// newS3Source create the S3 client of the source from its path, e.g. s3://bucket/records.yaml,
+// it uses the default credentials chain of the SDK unless the credentials option is given,
+// and the custom endpoint (e.g. MinIO) is addressed in path-style
+func newS3Source(src *Source) (*s3Source, error) {
+	u, err := url.Parse(src.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("both bucket and key are required: %s", src.Path)
+	}
+	if !hasSuffixes(key, ".json", ".yaml", ".yml") {
+		return nil, fmt.Errorf("key must be a JSON or YAML object: %s", src.Path)
+	}
+
+	cfg := &aws.Config{
+		HTTPClient: &http.Client{Transport: sourceTransport{src}},
+	}
+	if src.Region != "" {
+		cfg.Region = aws.String(src.Region)
+	}
+	if src.Endpoint != "" {
+		cfg.Endpoint = aws.String(src.Endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	if src.Username != "" && src.Password != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(src.Username, src.Password, "")
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Source{client: s3.New(sess), bucket: u.Host, key: key}, nil
+}
+
+// sourceTransport send the requests of the S3 client through the current transport of the source,
+// so the rotated TLS certificates are picked up by the client created once
+type sourceTransport struct {
+	src *Source
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t sourceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.src.httpTransport().RoundTrip(r)
+}
+
+// hasSuffixes report whether the string ends with any of the suffixes
+func hasSuffixes(s string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package views
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// digest return the hash of the records of the view, along with its SOA and the weight and order of the records,
+// so the views are compared between the reloads regardless of the order of their names
+func (zs Zones) digest() uint64 {
+	names := make([]string, 0, len(zs.Names))
+	names = append(names, zs.Names...)
+	sort.Strings(names)
+
+	h := fnv.New64a()
+	if zs.SOA != nil {
+		fmt.Fprintln(h, zs.SOA.String())
+	}
+	for _, name := range names {
+		node := zs.Z[name]
+
+		qtypes := make([]int, 0, len(node))
+		for qtype := range node {
+			qtypes = append(qtypes, int(qtype))
+		}
+		sort.Ints(qtypes)
+
+		for _, qtype := range qtypes {
+			for _, z := range node[uint16(qtype)] {
+				fmt.Fprintln(h, z.RR.String())
+				if z.Weight != nil {
+					fmt.Fprintln(h, "weight", *z.Weight)
+				}
+				if z.Order != nil {
+					fmt.Fprintln(h, "order", *z.Order)
+				}
+			}
+		}
+	}
+	return h.Sum64()
+}
+
+// trackSerials set the serial of every view, the view which records are not changed since
+// the previous config keeps its serial, otherwise its serial is bumped so it is always increased,
+// the serial starts from the one configured on the SOA of the view when it is ahead of the clock
+func trackSerials(prevZones, clientZones map[string]Zones) {
+	now := uint32(time.Now().Unix())
+
+	for name, zones := range clientZones {
+		zones.Serial = now
+		if zones.SOA != nil && zones.SOA.Serial > zones.Serial {
+			zones.Serial = zones.SOA.Serial
+		}
+
+		if prev, ok := prevZones[name]; ok {
+			if prev.digest() == zones.digest() {
+				zones.Serial = prev.Serial
+			} else if zones.Serial <= prev.Serial {
+				zones.Serial = prev.Serial + 1
+			}
+		}
+		clientZones[name] = zones
+	}
+}
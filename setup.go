@@ -1,12 +1,12 @@
 package views
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net"
-	"net/http"
-	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,12 +14,15 @@ import (
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	coreparse "github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
-	"gopkg.in/yaml.v2"
 )
 
 const (
 	defaultReloadInterval = 30 * time.Second
+	defaultHTTPTimeout    = 60 * time.Second
+
+	resolveHostnameTimeout = 5 * time.Second
 )
 
 var (
@@ -34,16 +37,51 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("views", err)
 	}
 
+	// the first load is done synchronously when the config is validated on startup,
+	// so the server refuses to start with unreachable or malformed sources
+	if v.ValidateOnStartup {
+		if err := v.loadConfig(); err != nil {
+			v.closeSources()
+			return plugin.Error("views", err)
+		}
+	}
+
 	reloadChan := v.reload()
 
 	c.OnStartup(func() error {
-		v.loadConfig()
+		if !v.ValidateOnStartup {
+			if err := v.loadConfig(); err != nil {
+				log.Error(err)
+			}
+		}
+
+		if err := v.watch(); err != nil {
+			return err
+		}
+
+		if v.TransferListen != "" {
+			if err := v.startTransfer(); err != nil {
+				return err
+			}
+		}
+
+		if v.Admin != "" {
+			return v.startAdmin()
+		}
 		return nil
 	})
 
 	c.OnShutdown(func() error {
+		v.cancel()
 		close(reloadChan)
-		return nil
+		if err := v.unwatch(); err != nil {
+			log.Error(err)
+		}
+		v.closeSources()
+		if err := v.stopTransfer(); err != nil {
+			log.Error(err)
+		}
+		return v.stopAdmin()
 	})
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
@@ -57,45 +95,347 @@ func setup(c *caddy.Controller) error {
 func parse(c *caddy.Controller) (*Views, error) {
 	v := Views{
 		ReloadInterval: defaultReloadInterval,
+		HTTPTimeout:    defaultHTTPTimeout,
 		Upstream:       upstream.New(),
+		trigger:        make(chan chan error),
 	}
+	v.ctx, v.cancel = context.WithCancel(context.Background())
 
 	for c.Next() {
 		for c.NextBlock() {
 			switch c.Val() {
 			case "client":
-				cl := c.RemainingArgs()[0]
-				s, err := schemaCheck(cl)
+				srcs, err := parseSource(c, false)
 				if err != nil {
 					return nil, err
 				}
-				v.Client = cl
-				v.ClientSchema = s
+				v.Clients = append(v.Clients, srcs...)
 			case "record":
-				re := c.RemainingArgs()[0]
-				s, err := schemaCheck(re)
+				srcs, err := parseSource(c, true)
 				if err != nil {
 					return nil, err
 				}
-				v.Record = re
-				v.RecordSchema = s
+				v.Records = append(v.Records, srcs...)
+			case "config":
+				srcs, err := parseSource(c, false)
+				if err != nil {
+					return nil, err
+				}
+				for _, src := range srcs {
+					if err := src.singleDocument(); err != nil {
+						return nil, err
+					}
+				}
+				v.Configs = append(v.Configs, srcs...)
 			case "reload":
-				d, err := time.ParseDuration(c.RemainingArgs()[0])
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
 				if err != nil {
 					return nil, err
 				}
 				v.ReloadInterval = d
+			case "http_timeout":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, err
+				}
+				v.HTTPTimeout = d
+			case "max_answers", "max_records":
+				option := c.Val()
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid %s: %s", option, args[0])
+				}
+				if option == "max_answers" {
+					v.MaxAnswers = n
+				} else {
+					v.MaxRecords = n
+				}
+			case "slow_reload_threshold":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, err
+				}
+				v.SlowReloadThreshold = d
+			case "http_retries":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid http_retries: %s", args[0])
+				}
+				v.HTTPRetries = n
+			case "http_user_agent":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				ua, err := expandUserAgent(args[0])
+				if err != nil {
+					return nil, err
+				}
+				v.HTTPUserAgent = ua
+			case "min_ttl", "max_ttl":
+				option := c.Val()
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				ttl, err := strconv.ParseUint(args[0], 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %s", option, args[0])
+				}
+				if option == "min_ttl" {
+					v.MinTTL = uint32(ttl)
+				} else {
+					v.MaxTTL = uint32(ttl)
+				}
+			case "allow", "deny":
+				option := c.Val()
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				nets, err := parseNets(args)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s source: %s", option, err)
+				}
+				if option == "allow" {
+					v.Allow = append(v.Allow, nets...)
+				} else {
+					v.Deny = append(v.Deny, nets...)
+				}
+			case "transfer":
+				args := c.RemainingArgs()
+				if len(args) > 0 {
+					if len(args) < 2 || args[0] != "to" {
+						return nil, c.ArgErr()
+					}
+					nets, err := parseNets(args[1:])
+					if err != nil {
+						return nil, fmt.Errorf("invalid transfer source: %s", err)
+					}
+					v.TransferTo = append(v.TransferTo, nets...)
+				}
+				keys, listen := len(v.TransferKeys), v.TransferListen
+				if err := v.parseTransferBlock(c); err != nil {
+					return nil, err
+				}
+				if len(args) == 0 && len(v.TransferKeys) == keys && v.TransferListen == listen {
+					return nil, c.ArgErr()
+				}
+			case "notify":
+				args := c.RemainingArgs()
+				if len(args) < 2 || args[0] != "to" {
+					return nil, c.ArgErr()
+				}
+				addrs, err := parseNotifyTo(args[1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid notify secondary: %s", err)
+				}
+				v.NotifyTo = append(v.NotifyTo, addrs...)
+			case "admin":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				v.Admin = args[0]
+			case "strict":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				v.Strict = true
+			case "validate_on_startup":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				v.ValidateOnStartup = true
+			case "local":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				v.Local = true
+			case "minimize_any":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				v.MinimizeAny = true
+			case "compress":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "on":
+					v.NoCompress = false
+				case "off":
+					v.NoCompress = true
+				default:
+					return nil, fmt.Errorf("invalid compress: %s", args[0])
+				}
+			case "use_ecs":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				v.UseECS = true
+			case "fallthrough":
+				v.Fall.SetZonesFromArgs(c.RemainingArgs())
+			case "fallback":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				v.Fallback = args[0]
+			case "no_match_policy":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case NoMatchRefuse, NoMatchNXDomain, NoMatchFallthrough, NoMatchDefaultView:
+				default:
+					return nil, fmt.Errorf("invalid no_match_policy: %s", args[0])
+				}
+				v.NoMatchPolicy = args[0]
+			case "name_precedence":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case NamePrecedenceClient, NamePrecedenceName:
+				default:
+					return nil, fmt.Errorf("invalid name_precedence: %s", args[0])
+				}
+				v.NamePrecedence = args[0]
+			case "rate_limit":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				qps, err := strconv.Atoi(args[0])
+				if err != nil || qps <= 0 {
+					return nil, fmt.Errorf("invalid rate_limit qps: %s", args[0])
+				}
+				limit := RateLimit{QPS: qps, Burst: qps}
+				args = args[1:]
+				if len(args) > 0 && args[0] != "view" {
+					burst, err := strconv.Atoi(args[0])
+					if err != nil || burst <= 0 {
+						return nil, fmt.Errorf("invalid rate_limit burst: %s", args[0])
+					}
+					limit.Burst = burst
+					args = args[1:]
+				}
+				if len(args) == 0 {
+					v.RateLimit = limit
+					break
+				}
+				// the views are given after the view keyword, so a numeric view name is never taken as the burst
+				if args[0] != "view" || len(args) == 1 {
+					return nil, c.ArgErr()
+				}
+				args = args[1:]
+				if v.ViewRateLimits == nil {
+					v.ViewRateLimits = make(map[string]RateLimit)
+				}
+				for _, view := range args {
+					v.ViewRateLimits[view] = limit
+				}
+			case "rewrite":
+				args := c.RemainingArgs()
+				if len(args) != 3 {
+					return nil, c.ArgErr()
+				}
+				rw, err := newTargetRewriter(args[1], args[2])
+				if err != nil {
+					return nil, err
+				}
+				v.AddRewriter(args[0], rw)
+			case "dns64":
+				args := c.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				prefix := defaultDNS64Prefix
+				if len(args) == 2 {
+					prefix = args[1]
+				}
+				prefixNet, err := parseDNS64Prefix(prefix)
+				if err != nil {
+					return nil, err
+				}
+				if v.DNS64 == nil {
+					v.DNS64 = make(map[string]*net.IPNet)
+				}
+				v.DNS64[args[0]] = prefixNet
+			case "cookies":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				secret, err := parseCookieSecret(strings.Join(args, ""))
+				if err != nil {
+					return nil, err
+				}
+				v.CookieSecret = secret
+			case "dnssec":
+				if err := v.parseDNSSEC(c); err != nil {
+					return nil, err
+				}
 			default:
 				return nil, fmt.Errorf("unknown argument: %s", c.Val())
 			}
 		}
 	}
 
-	if v.Client == "" {
+	if v.NoMatchPolicy == NoMatchDefaultView && v.Fallback == "" {
+		return nil, fmt.Errorf("no_match_policy %s requires the fallback view", NoMatchDefaultView)
+	}
+	if v.NoMatchPolicy != "" && v.NoMatchPolicy != NoMatchDefaultView && v.Fallback != "" {
+		return nil, fmt.Errorf("fallback conflicts with no_match_policy %s", v.NoMatchPolicy)
+	}
+
+	if v.MaxTTL != 0 && v.MinTTL > v.MaxTTL {
+		return nil, fmt.Errorf("min_ttl (%d) is greater than max_ttl (%d)", v.MinTTL, v.MaxTTL)
+	}
+
+	// the server of CoreDNS knows no TSIG key, so the signed transfers require the transfer listener
+	if len(v.TransferKeys) > 0 && v.TransferListen == "" {
+		return nil, fmt.Errorf("transfer key requires the transfer listen address")
+	}
+
+	v.Zones = make([]string, len(c.ServerBlockKeys))
+	for i, key := range c.ServerBlockKeys {
+		v.Zones[i] = plugin.Host(key).Normalize()
+	}
+
+	if err := v.setupSigners(); err != nil {
+		return nil, err
+	}
+
+	if len(v.Clients) == 0 && len(v.Configs) == 0 {
 		return nil, fmt.Errorf("required argument is missing: 'client'")
 	}
 
-	if v.Record == "" {
+	if len(v.Records) == 0 && len(v.Configs) == 0 {
 		return nil, fmt.Errorf("required argument is missing: 'record'")
 	}
 
@@ -106,13 +446,25 @@ func (v *Views) reload() chan bool {
 	reloadChan := make(chan bool)
 
 	go func() {
-		ticker := time.NewTicker(v.ReloadInterval)
+		// the periodic reload is disabled for a zero or negative interval,
+		// while the triggered reload is still served
+		var tick <-chan time.Time
+		if v.ReloadInterval > 0 {
+			ticker := time.NewTicker(v.ReloadInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
 		for {
 			select {
 			case <-reloadChan:
 				return
-			case <-ticker.C:
-				v.loadConfig()
+			case <-tick:
+				if err := v.loadConfig(); err != nil {
+					log.Error(err)
+				}
+			case resp := <-v.trigger:
+				resp <- v.loadConfig()
 			}
 		}
 	}()
@@ -120,131 +472,685 @@ func (v *Views) reload() chan bool {
 	return reloadChan
 }
 
-func (v *Views) loadConfig() {
-	var (
-		rawClients []RawClientACL
-		rawRecords []RawRecord
-		err        error
-	)
+// loadConfig fetch both client and record sources, then build and validate them,
+// the clients and records each replace the current ones when those are succeeded,
+// otherwise their last good config is kept
+func (v *Views) loadConfig() (err error) {
+	start := time.Now()
+	timing := new(reloadTiming)
+	defer func() {
+		elapsed := time.Since(start)
+		reloadDuration.Observe(elapsed.Seconds())
+		v.logSlowReload(timing, elapsed)
+
+		if err != nil {
+			reloadCount.WithLabelValues("failure").Inc()
+			servingStale.Set(1)
+			reloadFailures.Inc()
+			return
+		}
+		reloadCount.WithLabelValues("success").Inc()
+		lastReloadTimestamp.SetToCurrentTime()
+		servingStale.Set(0)
+		reloadFailures.Set(0)
+	}()
+	defer v.logFreshness()
+
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+
+	// the reloads are serialized, so the snapshot is only published here
+	prev := v.current()
+	prevACLs, prevZones := prev.clientACLs, prev.clientZones
+
+	clientACLs, clientZones := prevACLs, prevZones
+
+	// the clients and records are loaded independently, a failure on one of them
+	// keeps its last good config while the other one is still applied
+	var errs []string
+
+	// the combined config sources hold both of the clients and records, so a failure on them fails both
+	configs, configModified, clientErr := v.fetchConfigs(timing)
+	recordErr := clientErr
+
+	var clientModified, recordModified bool
+	if clientErr != nil {
+		errs = append(errs, clientErr.Error())
+	} else {
+		var newACLs []*ClientACL
+		newACLs, clientModified, clientErr = v.loadClients(timing, configs, configModified)
+		if clientErr != nil {
+			errs = append(errs, clientErr.Error())
+		} else if clientModified {
+			clientACLs = newACLs
+		}
+
+		var newZones map[string]Zones
+		newZones, recordModified, recordErr = v.loadRecords(timing, configs, configModified)
+		if recordErr != nil {
+			errs = append(errs, recordErr.Error())
+		} else if recordModified {
+			trackSerials(prevZones, newZones)
+			clientZones = newZones
+		}
+	}
+
+	if len(errs) > 0 {
+		err = errors.New(strings.Join(errs, "; "))
+	}
 
-	switch v.ClientSchema {
-	case SchemaYAML:
-		err = parseFromYAML(v.Client, &rawClients)
-	case SchemaHTTP:
-		err = parseFromHTTP(v.Client, &rawClients)
+	if (clientErr != nil || !clientModified) && (recordErr != nil || !recordModified) {
+		if err == nil {
+			log.Debug("config is not modified since the last reload")
+		}
+
+		// the unmodified sources are still fresh as long as they have been loaded before
+		next := prev.clone()
+		if clientErr == nil && prev.clientsLoaded {
+			next.markLoaded(v.Clients, start)
+		}
+		if recordErr == nil && prev.recordsLoaded {
+			next.markLoaded(v.Records, start)
+		}
+		if clientErr == nil && recordErr == nil && prev.clientsLoaded && prev.recordsLoaded {
+			next.markLoaded(v.Configs, start)
+		}
+		v.publish(next)
+		return err
+	}
+
+	clientsLoaded := prev.clientsLoaded || clientErr == nil
+	recordsLoaded := prev.recordsLoaded || recordErr == nil
+	if verr := validateConfig(clientACLs, clientZones, clientsLoaded, recordsLoaded); verr != nil {
+		// the modified halves are validated against the last good config of the other half,
+		// so the valid one is still applied while the invalid one keeps its last good config
+		if clientErr == nil && clientModified {
+			if clientErr = validateConfig(clientACLs, prevZones, true, prev.recordsLoaded); clientErr != nil {
+				errs = append(errs, fmt.Sprintf("invalid clients, keeping the previous ones: %v", clientErr))
+				clientACLs, clientsLoaded, clientModified = prevACLs, prev.clientsLoaded, false
+			}
+		}
+		if recordErr == nil && recordModified {
+			if recordErr = validateConfig(clientACLs, clientZones, clientsLoaded, true); recordErr != nil {
+				errs = append(errs, fmt.Sprintf("invalid records, keeping the previous ones: %v", recordErr))
+				clientZones, recordsLoaded, recordModified = prevZones, prev.recordsLoaded, false
+			}
+		}
+
+		if !clientModified && !recordModified {
+			if err != nil {
+				return fmt.Errorf("invalid config, keeping the previous one: %v; %v", verr, err)
+			}
+			return fmt.Errorf("invalid config, keeping the previous one: %v", verr)
+		}
+		err = errors.New(strings.Join(errs, "; "))
+	}
+
+	next := prev.clone()
+	next.clientACLs = clientACLs
+	next.clientZones = clientZones
+	next.clientsLoaded, next.recordsLoaded = clientsLoaded, recordsLoaded
+	if clientErr == nil {
+		next.markLoaded(v.Clients, start)
+	}
+	if recordErr == nil {
+		next.markLoaded(v.Records, start)
+	}
+	if clientErr == nil && recordErr == nil {
+		next.markLoaded(v.Configs, start)
 	}
+	next.warmup()
+	v.publish(next)
 
+	v.notifyChanges(prevACLs, prevZones, clientACLs, clientZones)
+
+	return err
+}
+
+// loadClients fetch and build the client ACLs along with the ones of the combined configs,
+// it also reports whether the clients are modified
+func (v *Views) loadClients(timing *reloadTiming, configs []*RawConfigDocument, configModified bool) ([]*ClientACL, bool, error) {
+	rawClients, modified, err := v.fetchClients(timing, configs, configModified)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the clients with hostnames are always rebuilt so the changed addresses are picked up
+	if !modified && !hasHostnames(rawClients) {
+		return nil, false, nil
+	}
+
+	start := time.Now()
+	clientACLs, err := NewClientACLs(rawClients, v.Strict)
+	timing.track("client build", start)
 	if err != nil {
-		log.Error(err)
+		return nil, false, fmt.Errorf("invalid client config, keeping the previous one: %v", err)
 	}
+	return clientACLs, true, nil
+}
 
-	switch v.RecordSchema {
-	case SchemaYAML:
-		err = parseFromYAML(v.Record, &rawRecords)
-	case SchemaHTTP:
-		err = parseFromHTTP(v.Record, &rawRecords)
+// loadRecords fetch and build the view zones along with the ones of the combined configs,
+// it also reports whether the records are modified
+func (v *Views) loadRecords(timing *reloadTiming, configs []*RawConfigDocument, configModified bool) (map[string]Zones, bool, error) {
+	rawRecords, modified, err := v.fetchRecords(timing, configs, configModified)
+	if err != nil || !modified {
+		return nil, false, err
 	}
+
+	start := time.Now()
+	clientZones, err := NewClientZones(rawRecords, v.Strict)
+	timing.track("record build", start)
 	if err != nil {
-		log.Error(err)
+		return nil, false, fmt.Errorf("invalid record config, keeping the previous one: %v", err)
+	}
+	capRecords(clientZones, v.MaxRecords)
+	return clientZones, true, nil
+}
+
+// fetchConfigs fetch all of the combined config sources, it also reports whether any of them is modified
+func (v *Views) fetchConfigs(timing *reloadTiming) ([]*RawConfigDocument, bool, error) {
+	var (
+		docs     []*RawConfigDocument
+		modified bool
+	)
+
+	for _, src := range v.Configs {
+		doc := new(RawConfigDocument)
+		start := time.Now()
+		m, err := v.fetch(src, doc)
+		timing.track("config fetch "+src.Path, start)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load config from %s: %v", src.Path, err)
+		}
+		if err := v.checkVersion(src, doc.Version); err != nil {
+			return nil, false, err
+		}
+		modified = modified || m
+		docs = append(docs, doc)
+	}
+
+	return docs, modified, nil
+}
+
+// fetchClients fetch all of client sources and merge them in order following the clients of the combined configs,
+// when the same client is declared in several sources the last one wins
+func (v *Views) fetchClients(timing *reloadTiming, configs []*RawConfigDocument, configModified bool) ([]RawClientACL, bool, error) {
+	var (
+		merged   []RawClientACL
+		modified = configModified
+		index    = make(map[string]int)
+	)
+
+	add := func(client RawClientACL, path string) {
+		if i, ok := index[client.Name]; ok {
+			log.Warningf("(%s) client is declared more than once, using the one from %s", client.Name, path)
+			merged[i] = client
+			return
+		}
+		index[client.Name] = len(merged)
+		merged = append(merged, client)
+	}
+
+	for i, doc := range configs {
+		for _, client := range applyTagRules(v.Configs[i].TagRules, doc.Clients) {
+			add(client, v.Configs[i].Path)
+		}
+	}
+
+	for _, src := range v.Clients {
+		var doc RawClientDocument
+		start := time.Now()
+		m, err := v.fetch(src, &doc)
+		timing.track("client fetch "+src.Path, start)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load client from %s: %v", src.Path, err)
+		}
+		if err := v.checkVersion(src, doc.Version); err != nil {
+			return nil, false, err
+		}
+		modified = modified || m
+
+		for _, client := range applyTagRules(src.TagRules, doc.Clients) {
+			add(client, src.Path)
+		}
+	}
+
+	return merged, modified, nil
+}
+
+// fetchRecords fetch all of record sources and merge them in order following the views of the combined configs,
+// when the same view is declared in several sources the last one wins, including the sources dedicated to a view
+func (v *Views) fetchRecords(timing *reloadTiming, configs []*RawConfigDocument, configModified bool) ([]RawRecord, bool, error) {
+	var (
+		merged   []RawRecord
+		modified = configModified
+		index    = make(map[string]int)
+	)
+
+	add := func(record RawRecord, path string) {
+		if i, ok := index[record.Name]; ok {
+			log.Warningf("(%s) view is declared more than once, using the one from %s", record.Name, path)
+			merged[i] = record
+			return
+		}
+		index[record.Name] = len(merged)
+		merged = append(merged, record)
+	}
+
+	for i, doc := range configs {
+		for _, record := range doc.Records {
+			add(record, v.Configs[i].Path)
+		}
+	}
+
+	for _, src := range v.Records {
+		var doc RawRecordDocument
+		start := time.Now()
+		m, err := v.fetch(src, &doc)
+		timing.track("record fetch "+src.Path, start)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load record from %s: %v", src.Path, err)
+		}
+		if err := v.checkVersion(src, doc.Version); err != nil {
+			return nil, false, err
+		}
+		modified = modified || m
+
+		for _, record := range dedicatedViews(src, doc.Views) {
+			add(record, src.Path)
+		}
+	}
+
+	return merged, modified, nil
+}
+
+// dedicatedViews return the views of the source, the source dedicated to a view
+// takes the unnamed views as the view, and the views of other names are skipped
+func dedicatedViews(src *Source, views []RawRecord) []RawRecord {
+	if src.View == "" {
+		return views
 	}
 
-	v.ClientACLs = []*ClientACL{}
+	dedicated := make([]RawRecord, 0, len(views))
+	for _, record := range views {
+		if record.Name != "" && record.Name != src.View {
+			log.Warningf("(%s) view is skipped as %s is dedicated to view %s", record.Name, src.Path, src.View)
+			continue
+		}
+		record.Name = src.View
+		dedicated = append(dedicated, record)
+	}
+	return dedicated
+}
+
+// NewClientACLs build the client ACLs from its raw specification, the invalid CIDR prefix
+// is skipped with a warning, or failing the whole build on strict mode,
+// it also builds the clients given to NewViews by the programs embedding the plugin
+func NewClientACLs(rawClients []RawClientACL, strict bool) ([]*ClientACL, error) {
+	clientACLs := []*ClientACL{}
 
+	var dropped int
 	for _, client := range rawClients {
 		var cidrNets []*net.IPNet
 		for _, cidr := range client.CIDRPrefixes {
 			_, cidrNet, err := net.ParseCIDR(cidr)
 			if err != nil {
+				if strict {
+					return nil, fmt.Errorf("(%s) %s", client.Name, err)
+				}
+				log.Warningf("(%s) %s", client.Name, err)
+				droppedCount.WithLabelValues(droppedBadCIDR).Inc()
+				dropped++
+				continue
+			}
+			cidrNets = append(cidrNets, normalizeNet(cidrNet))
+		}
+
+		for _, hostname := range client.Hostnames {
+			nets, err := resolveHostname(hostname)
+			if err != nil {
+				log.Warningf("(%s) failed to resolve hostname %s, skipping it: %v", client.Name, hostname, err)
+				continue
+			}
+			cidrNets = append(cidrNets, nets...)
+		}
+
+		var serverNets []*net.IPNet
+		for _, cidr := range client.ServerCIDRs {
+			serverNet, err := parseServerCIDR(cidr)
+			if err != nil {
+				if strict {
+					return nil, fmt.Errorf("(%s) %s", client.Name, err)
+				}
 				log.Warningf("(%s) %s", client.Name, err)
+				droppedCount.WithLabelValues(droppedBadCIDR).Inc()
+				dropped++
 				continue
 			}
-			cidrNets = append(cidrNets, cidrNet)
+			serverNets = append(serverNets, serverNet)
+		}
+
+		disabled := client.Enabled != nil && !*client.Enabled
+		if disabled {
+			log.Infof("(%s) client is disabled, its prefixes are not matched", client.Name)
+		}
+
+		var canary *Canary
+		if client.Canary != nil {
+			var err error
+			if canary, err = newCanary(*client.Canary); err != nil {
+				if strict {
+					return nil, fmt.Errorf("(%s) %s", client.Name, err)
+				}
+				log.Warningf("(%s) %s, ignoring the canary", client.Name, err)
+			}
 		}
 
-		v.ClientACLs = append(v.ClientACLs, &ClientACL{
-			Name:     client.Name,
-			CIDRNets: cidrNets,
+		clientACLs = append(clientACLs, &ClientACL{
+			Name:       client.Name,
+			CIDRNets:   cidrNets,
+			ServerNets: serverNets,
+			Disabled:   disabled,
+			Canary:     canary,
 		})
 	}
 
-	v.ClientZones = make(map[string]Zones)
+	if dropped > 0 {
+		log.Warningf("%d invalid client prefixes are dropped", dropped)
+	}
+
+	return clientACLs, nil
+}
+
+// parseServerCIDR parse the server prefix of the client, which is either a CIDR prefix or an IP address
+func parseServerCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: cidr}
+		}
+		return hostNet(ip), nil
+	}
+
+	_, cidrNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeNet(cidrNet), nil
+}
+
+// hasHostnames report whether any of the clients has hostnames
+func hasHostnames(rawClients []RawClientACL) bool {
+	for _, client := range rawClients {
+		if len(client.Hostnames) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHostname resolve the hostname into the single host networks of its addresses
+func resolveHostname(hostname string) ([]*net.IPNet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveHostnameTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	nets := make([]*net.IPNet, 0, len(addrs))
+	for _, addr := range addrs {
+		nets = append(nets, hostNet(addr.IP))
+	}
+	return nets, nil
+}
+
+// NewClientZones build the zones of each view from its raw specification, the invalid record
+// is skipped with a warning, or failing the whole build on strict mode,
+// it also builds the views given to NewViews by the programs embedding the plugin
+func NewClientZones(rawRecords []RawRecord, strict bool) (map[string]Zones, error) {
+	clientZones := make(map[string]Zones)
+	inherits := make(map[string][]string)
+	serial := uint32(time.Now().Unix())
+
 	for _, raw := range rawRecords {
 		zones := Zones{
-			Names: []string{},
-			Z:     make(map[string]Zone),
+			Names:  []string{},
+			Z:      make(map[string]map[uint16][]Zone),
+			Serial: serial,
+			MinTTL: raw.MinTTL,
+			MaxTTL: raw.MaxTTL,
+			Parent: raw.Parent,
+		}
+
+		if raw.SOA != nil {
+			soa, err := NewSOA(*raw.SOA)
+			if err != nil {
+				if strict {
+					return nil, fmt.Errorf("(%s) %s", raw.Name, err)
+				}
+				log.Warningf("(%s) %s, using the default SOA", raw.Name, err)
+			}
+			zones.SOA = soa
+		}
+
+		var err error
+		if zones.AllowTypes, err = parseQTypes(raw.AllowTypes); err != nil {
+			if strict {
+				return nil, fmt.Errorf("(%s) %s", raw.Name, err)
+			}
+			log.Warningf("(%s) %s, ignoring them on the allowed types", raw.Name, err)
+		}
+		if zones.DenyTypes, err = parseQTypes(raw.DenyTypes); err != nil {
+			if strict {
+				return nil, fmt.Errorf("(%s) %s", raw.Name, err)
+			}
+			log.Warningf("(%s) %s, ignoring them on the denied types", raw.Name, err)
+		}
+		if zones.MatchNames, err = parseMatchNames(raw.MatchNames); err != nil {
+			if strict {
+				return nil, fmt.Errorf("(%s) %s", raw.Name, err)
+			}
+			log.Warningf("(%s) %s, ignoring them on the name matching", raw.Name, err)
+		}
+
+		if len(raw.Upstream) > 0 {
+			upstreams, err := coreparse.HostPortOrFile(raw.Upstream...)
+			if err != nil {
+				if strict {
+					return nil, fmt.Errorf("(%s) %s", raw.Name, err)
+				}
+				log.Warningf("(%s) %s, ignoring the upstream", raw.Name, err)
+			}
+			zones.Upstream = upstreams
 		}
 
+		var dropped, disabled int
 		for _, record := range raw.Records {
+			// the disabled record is staged in the config, so it is skipped before being validated
+			if record.Enabled != nil && !*record.Enabled {
+				disabled++
+				continue
+			}
+
 			rr, err := NewZoneRecord(record)
 			if err != nil {
+				if strict {
+					return nil, fmt.Errorf("(%s) %s", raw.Name, err)
+				}
 				log.Warningf("(%s) %s", raw.Name, err)
+				droppedCount.WithLabelValues(droppedReason(err)).Inc()
+				dropped++
 				continue
 			}
 
-			zones.Names = append(zones.Names, rr.Name)
-			zones.Z[rr.Name] = rr
+			if _, ok := zones.Z[rr.Name]; !ok {
+				zones.Names = append(zones.Names, rr.Name)
+				zones.Z[rr.Name] = make(map[uint16][]Zone)
+			}
+			zones.Z[rr.Name][rr.Type] = append(zones.Z[rr.Name][rr.Type], rr)
 		}
+		zones.sortByOrder()
 
-		v.ClientZones[raw.Name] = zones
-	}
-}
+		if dropped > 0 {
+			log.Warningf("(%s) %d of %d records are dropped", raw.Name, dropped, len(raw.Records))
+		}
+		if disabled > 0 {
+			log.Infof("(%s) %d of %d records are disabled", raw.Name, disabled, len(raw.Records))
+		}
 
-func parseFromYAML(filename string, out interface{}) error {
-	file, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return err
+		clientZones[raw.Name] = zones
+		if len(raw.Inherit) > 0 {
+			inherits[raw.Name] = raw.Inherit
+		}
 	}
 
-	err = yaml.Unmarshal(file, out)
-	if err != nil {
-		return err
+	if len(inherits) > 0 {
+		var err error
+		if clientZones, err = inheritZones(clientZones, inherits, strict); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	if err := checkParents(clientZones, strict); err != nil {
+		return nil, err
+	}
+	return clientZones, nil
 }
 
-func parseFromHTTP(endpoint string, out interface{}) (err error) {
-	u, err := url.Parse(endpoint)
-	if err != nil {
-		return
+// checkParents make sure the parent of every view exists and the parent chain has no cycle,
+// the invalid parent is dropped with a warning, or failing the whole build on strict mode
+func checkParents(clientZones map[string]Zones, strict bool) error {
+	names := make([]string, 0, len(clientZones))
+	for name := range clientZones {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	req, err := http.NewRequest(
-		http.MethodGet,
-		u.String(),
-		nil,
-	)
-	if err != nil {
-		return
+	for _, name := range names {
+		zones := clientZones[name]
+		if zones.Parent == "" {
+			continue
+		}
+
+		var err error
+		if _, ok := clientZones[zones.Parent]; !ok {
+			err = fmt.Errorf("(%s) parent view is not found: %s", name, zones.Parent)
+		} else if chain, cyclic := parentChain(clientZones, name); cyclic {
+			err = fmt.Errorf("(%s) parent cycle is detected: %s", name, strings.Join(chain, " -> "))
+		} else if len(chain) > maxParentChain {
+			err = fmt.Errorf("(%s) parent chain is longer than %d views", name, maxParentChain)
+		}
+
+		if err != nil {
+			if strict {
+				return err
+			}
+			log.Warningf("%s, ignoring the parent", err)
+			zones.Parent = ""
+			clientZones[name] = zones
+		}
 	}
+	return nil
+}
+
+// inheritZones seed the zones of each view from the zones of the views it inherits in order,
+// then override them with its own records, only the records are inherited while the settings
+// of the view are its own, and an inheritance cycle is always rejected
+func inheritZones(own map[string]Zones, inherits map[string][]string, strict bool) (map[string]Zones, error) {
+	merged := make(map[string]Zones, len(own))
+	visiting := make(map[string]bool)
+
+	var resolve func(name string) (Zones, error)
+	resolve = func(name string) (Zones, error) {
+		if zones, ok := merged[name]; ok {
+			return zones, nil
+		}
+		if visiting[name] {
+			return Zones{}, fmt.Errorf("(%s) inheritance cycle is detected", name)
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		// only the records are inherited, the view keeps its own settings (e.g. SOA, upstream and denied types)
+		zones := own[name]
+		zones.Names = []string{}
+		zones.Z = make(map[string]map[uint16][]Zone)
+
+		for _, parent := range inherits[name] {
+			if _, ok := own[parent]; !ok {
+				err := fmt.Errorf("(%s) inherited view is not found: %s", name, parent)
+				if strict {
+					return Zones{}, err
+				}
+				log.Warning(err)
+				continue
+			}
+
+			parentZones, err := resolve(parent)
+			if err != nil {
+				return Zones{}, err
+			}
+			zones.merge(parentZones)
+		}
+		zones.merge(own[name])
 
-	client := &http.Client{
-		Timeout: time.Duration(60) * time.Second,
+		merged[name] = zones
+		return zones, nil
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return
+	for name := range own {
+		if _, err := resolve(name); err != nil {
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return
+	return merged, nil
+}
+
+// validateConfig make sure the config is usable, which is at least
+// there is a client with a valid CIDR prefix and a view with a valid record, and the canary views exist,
+// the clients or records which are not loaded yet (e.g. failing on the first load)
+// are not validated, so the loaded half is still applied on its own
+func validateConfig(clientACLs []*ClientACL, clientZones map[string]Zones, clientsLoaded, recordsLoaded bool) error {
+	if clientsLoaded {
+		var hasCIDR bool
+		for _, client := range clientACLs {
+			if len(client.CIDRNets) > 0 || len(client.ServerNets) > 0 {
+				hasCIDR = true
+				break
+			}
+		}
+		if !hasCIDR {
+			return fmt.Errorf("no client with a valid CIDR prefix was found")
+		}
 	}
 
-	err = json.Unmarshal(body, out)
-	if err != nil {
-		return
+	if recordsLoaded {
+		var hasRecord bool
+		for _, zones := range clientZones {
+			if len(zones.Z) > 0 {
+				hasRecord = true
+				break
+			}
+		}
+		if !hasRecord {
+			return fmt.Errorf("no view with a valid record was found")
+		}
 	}
-	return
-}
 
-func schemaCheck(str string) (string, error) {
-	if strings.HasPrefix(str, "http://") || strings.HasPrefix(str, "https://") {
-		return SchemaHTTP, nil
-	} else if strings.HasSuffix(str, ".yaml") || strings.HasSuffix(str, ".yml") {
-		return SchemaYAML, nil
+	// the canary view must exist, otherwise its share of the clients would get no answer at all
+	if clientsLoaded && recordsLoaded {
+		for _, client := range clientACLs {
+			if client.Canary == nil {
+				continue
+			}
+			if _, ok := clientZones[client.Canary.View]; !ok {
+				return fmt.Errorf("(%s) canary view is not found: %s", client.Name, client.Canary.View)
+			}
+		}
 	}
-	return "", fmt.Errorf("unknown schema: %s", str)
+
+	return nil
 }
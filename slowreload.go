@@ -0,0 +1,40 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reloadStep represent of the time taken by a step of the reload, e.g. fetching a source
+type reloadStep struct {
+	name     string
+	duration time.Duration
+}
+
+// reloadTiming represent of the steps of a reload, which are logged once the reload is slow
+type reloadTiming struct {
+	steps []reloadStep
+}
+
+// track record the time taken by the step since its start
+func (t *reloadTiming) track(name string, start time.Time) {
+	t.steps = append(t.steps, reloadStep{name: name, duration: time.Since(start)})
+}
+
+// String implements the fmt.Stringer interface
+func (t *reloadTiming) String() string {
+	steps := make([]string, len(t.steps))
+	for i, step := range t.steps {
+		steps[i] = fmt.Sprintf("%s %s", step.name, step.duration.Round(time.Millisecond))
+	}
+	return strings.Join(steps, ", ")
+}
+
+// logSlowReload log the steps of the reload when it takes longer than the slow reload threshold
+func (v *Views) logSlowReload(timing *reloadTiming, elapsed time.Duration) {
+	if v.SlowReloadThreshold <= 0 || elapsed < v.SlowReloadThreshold {
+		return
+	}
+	log.Warningf("reload took %s, exceeding %s: %s", elapsed.Round(time.Millisecond), v.SlowReloadThreshold, timing)
+}
@@ -0,0 +1,76 @@
+package views
+
+import (
+	"sort"
+	"time"
+)
+
+// snapshot represent of the loaded clients and views along with the load state of their sources,
+// it is never modified once published, so each query reads a consistent config without any lock
+// while the reload builds the next one aside
+type snapshot struct {
+	clientACLs  []*ClientACL
+	clientZones map[string]Zones
+
+	// nameViews is the views having the name patterns ordered by their name, precomputed by warmup
+	nameViews []string
+
+	// clientsLoaded and recordsLoaded tell whether the clients and records have been loaded once
+	clientsLoaded bool
+	recordsLoaded bool
+
+	// loadedAt is the time of the last successful load of each source
+	loadedAt map[*Source]time.Time
+}
+
+// current return the snapshot which is currently served, it is empty until the first load
+func (v *Views) current() *snapshot {
+	if s, ok := v.config.Load().(*snapshot); ok {
+		return s
+	}
+	return &snapshot{}
+}
+
+// publish replace the served snapshot, the snapshot must not be modified afterward
+func (v *Views) publish(s *snapshot) {
+	v.config.Store(s)
+}
+
+// clone return a copy of the snapshot to be modified before it is published,
+// the clients and views are shared as they are replaced rather than modified
+func (s *snapshot) clone() *snapshot {
+	c := *s
+	c.loadedAt = make(map[*Source]time.Time, len(s.loadedAt))
+	for src, at := range s.loadedAt {
+		c.loadedAt[src] = at
+	}
+	return &c
+}
+
+// warmup precompute the structures derived from the views before the snapshot is published,
+// so the first queries after a reload do not pay for building them, the views which are
+// shared with the served snapshot are copied rather than modified
+func (s *snapshot) warmup() {
+	clientZones := make(map[string]Zones, len(s.clientZones))
+	var nameViews []string
+	for name, zones := range s.clientZones {
+		if zones.ents == nil {
+			zones.ents = zones.emptyNonTerminals()
+		}
+		clientZones[name] = zones
+
+		if len(zones.MatchNames) > 0 {
+			nameViews = append(nameViews, name)
+		}
+	}
+	sort.Strings(nameViews)
+
+	s.clientZones, s.nameViews = clientZones, nameViews
+}
+
+// markLoaded set the last successful load time of the sources
+func (s *snapshot) markLoaded(srcs []*Source, at time.Time) {
+	for _, src := range srcs {
+		s.loadedAt[src] = at
+	}
+}
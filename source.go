@@ -0,0 +1,912 @@
+package views
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	mwtls "github.com/coredns/coredns/plugin/pkg/tls"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	httpRetryBackoff    = 500 * time.Millisecond
+	httpRetryMaxBackoff = 10 * time.Second
+	// httpMaxPages is the maximum number of pages followed from a paginated HTTP source
+	httpMaxPages = 100
+)
+
+// Source represent of a config source along with the options to fetch it
+type Source struct {
+	Path   string
+	Schema string
+	// View is the view which the record source is dedicated to, empty means the source holds several views
+	View string
+
+	// Header is the additional headers sent along with the HTTP request
+	Header http.Header
+	// Username and Password is the credentials of HTTP basic authentication and etcd,
+	// or the access key ID and secret access key of S3
+	Username string
+	Password string
+	// BearerTokenEnv is the environment variable name holding the HTTP bearer token,
+	// it is read on every fetch so the token can be rotated without restart
+	BearerTokenEnv string
+	// Region and Endpoint is the region and the custom endpoint (e.g. MinIO) of the S3 source
+	Region   string
+	Endpoint string
+	// TLSConfig is the TLS config to connect to the HTTPS, etcd, Consul and S3 source
+	TLSConfig *tls.Config
+	// Token is the ACL token of the Consul source
+	Token string
+	// InsecureSkipVerify disables the verification of the server certificate, it is unsafe
+	// as the source is open to man-in-the-middle attacks, so only meant for development setups
+	InsecureSkipVerify bool
+	// TagRules map the tags of the clients of the source into their name, in order
+	TagRules []TagRule
+	// CacheFile is the local file holding the last fetched body of the HTTP source,
+	// which is loaded instead when the source is unreachable on startup
+	CacheFile string
+
+	// tlsFiles is the certificate files of TLSConfig, and tlsModTime is their latest modification time
+	// when TLSConfig is built, it is rebuilt for the HTTPS, Consul and S3 source once any of them is modified
+	tlsFiles   []string
+	tlsModTime time.Time
+	transport  *http.Transport
+
+	// loaded tells the source has been loaded once, either fetched or from its cache file,
+	// so the cache file is only read until the first load
+	loaded bool
+
+	cache       *httpCache
+	etcd        *etcdSource
+	s3          *s3Source
+	consulIndex string
+}
+
+// sourceOptions is the schemas of the sources supported by each of the source options
+var sourceOptions = map[string][]string{
+	"header":               {SchemaHTTP},
+	"basic_auth":           {SchemaHTTP},
+	"bearer_token_env":     {SchemaHTTP},
+	"tls":                  {SchemaHTTP, SchemaEtcd, SchemaConsul, SchemaS3},
+	"insecure_skip_verify": {SchemaHTTP, SchemaEtcd, SchemaConsul, SchemaS3},
+	"credentials":          {SchemaEtcd, SchemaS3},
+	"token":                {SchemaConsul},
+	"region":               {SchemaS3},
+	"endpoint":             {SchemaS3},
+	"tag_rule":             {SchemaYAML, SchemaJSON, SchemaHTTP, SchemaEtcd, SchemaConsul, SchemaS3},
+	"cache_file":           {SchemaHTTP},
+}
+
+// httpCache represent of the cache validators of the last HTTP response along with its body
+type httpCache struct {
+	ETag         string
+	LastModified string
+	Body         []byte
+}
+
+// parseSource parse the source arguments along with its optional block of options
+// which are applied to each of them, e.g.
+//
+//	record https://example.com/records https://example.com/more-records {
+//	    header X-Team dns
+//	    basic_auth user password
+//	    bearer_token_env RECORD_TOKEN
+//	    tls client.pem client-key.pem ca.pem
+//	}
+//
+//	record https://config.internal/records {
+//	    cache_file /var/cache/coredns/records.json
+//	}
+//
+//	record https://config.internal/records {
+//	    insecure_skip_verify
+//	}
+//
+//	client etcd://10.0.0.1:2379/dns/clients {
+//	    tls cert.pem key.pem ca.pem
+//	    credentials user password
+//	}
+//
+//	record consul://10.0.0.1:8500/dns/records {
+//	    token CONSUL_TOKEN
+//	}
+//
+//	record s3://dns-config/records.yaml {
+//	    region us-east-1
+//	    endpoint https://minio.internal:9000
+//	    credentials ACCESS_KEY_ID SECRET_ACCESS_KEY
+//	}
+//
+//	client https://ipam.internal/export {
+//	    tag_rule regex ^site-(\w+)$ dc-$1
+//	    tag_rule suffix -internal internal
+//	}
+//
+// when named is true, the sources may be preceded by the view which they are dedicated to, e.g.
+//
+//	record view dc1 https://example.com/records/dc1
+func parseSource(c *caddy.Controller, named bool) ([]*Source, error) {
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return nil, c.ArgErr()
+	}
+
+	var view string
+	if named && args[0] == "view" {
+		if len(args) < 3 {
+			return nil, c.ArgErr()
+		}
+		view, args = args[1], args[2:]
+	}
+
+	srcs := make([]*Source, 0, len(args))
+	for _, arg := range args {
+		schema, err := schemaCheck(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		srcs = append(srcs, &Source{
+			Path:   arg,
+			Schema: schema,
+			View:   view,
+			Header: make(http.Header),
+		})
+	}
+
+	if !c.NextArg() {
+		return srcs, nil
+	}
+	if c.Val() != "{" {
+		return nil, c.ArgErr()
+	}
+
+	for c.Next() {
+		if c.Val() == "}" {
+			for _, src := range srcs {
+				if err := src.skipVerify(); err != nil {
+					return nil, err
+				}
+			}
+			return srcs, nil
+		}
+
+		option := c.Val()
+		args := c.RemainingArgs()
+
+		schemas, ok := sourceOptions[option]
+		if !ok {
+			return nil, fmt.Errorf("unknown source option: %s", option)
+		}
+		if option == "tag_rule" && named {
+			return nil, fmt.Errorf("option '%s' is only supported for client source", option)
+		}
+		if option == "cache_file" && len(srcs) > 1 {
+			return nil, fmt.Errorf("option '%s' requires a single source", option)
+		}
+
+		for _, src := range srcs {
+			if !hasSchema(schemas, src.Schema) {
+				return nil, fmt.Errorf("option '%s' is only supported for %s source: %s", option, strings.Join(schemas, ", "), src.Path)
+			}
+
+			switch option {
+			case "header":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				src.Header.Add(args[0], args[1])
+			case "basic_auth":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				src.Username, src.Password = args[0], args[1]
+			case "bearer_token_env":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				src.BearerTokenEnv = args[0]
+			case "tls":
+				tlsConfig, err := mwtls.NewTLSConfigFromArgs(args...)
+				if err != nil {
+					return nil, err
+				}
+				src.TLSConfig = tlsConfig
+				src.tlsFiles, src.tlsModTime = args, latestModTime(args)
+			case "credentials":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				src.Username, src.Password = args[0], args[1]
+			case "token":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				src.Token = args[0]
+			case "region":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				src.Region = args[0]
+			case "endpoint":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				src.Endpoint = args[0]
+			case "insecure_skip_verify":
+				if len(args) != 0 {
+					return nil, c.ArgErr()
+				}
+				src.InsecureSkipVerify = true
+			case "tag_rule":
+				rule, err := parseTagRule(args)
+				if err != nil {
+					return nil, err
+				}
+				src.TagRules = append(src.TagRules, rule)
+			case "cache_file":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				src.CacheFile = args[0]
+			}
+		}
+	}
+
+	return nil, c.EOFErr()
+}
+
+// skipVerify disable the verification of the server certificate when the source is insecure
+func (src *Source) skipVerify() error {
+	if !src.InsecureSkipVerify {
+		return nil
+	}
+
+	if src.TLSConfig == nil {
+		tlsConfig, err := mwtls.NewTLSConfigFromArgs()
+		if err != nil {
+			return err
+		}
+		src.TLSConfig = tlsConfig
+	}
+	src.TLSConfig.InsecureSkipVerify = true
+
+	log.Warningf("TLS verification of %s is disabled, this is unsafe and not meant for production", src.Path)
+	return nil
+}
+
+// hasSchema report whether the schema is one of the schemas
+func hasSchema(schemas []string, schema string) bool {
+	for _, s := range schemas {
+		if s == schema {
+			return true
+		}
+	}
+	return false
+}
+
+// sources return all of the client, record and combined config sources
+func (v *Views) sources() []*Source {
+	srcs := make([]*Source, 0, len(v.Clients)+len(v.Records)+len(v.Configs))
+	srcs = append(srcs, v.Clients...)
+	srcs = append(srcs, v.Records...)
+	return append(srcs, v.Configs...)
+}
+
+// singleDocument make sure the source holds a single document, as required by the combined config,
+// so neither the sources storing an entry per key nor the directory and glob sources are supported
+func (src *Source) singleDocument() error {
+	switch {
+	case src.Schema == SchemaEtcd,
+		src.Schema == SchemaConsul && strings.HasSuffix(src.Path, "/"),
+		src.Schema == SchemaYAML && (isGlob(src.Path) || isDir(src.Path)):
+		return fmt.Errorf("config source must be a single document: %s", src.Path)
+	}
+	return nil
+}
+
+// fetch load the source and decode it into out, it also reports whether the source is modified
+// since the last fetch, which is always true for the source that does not support caching
+func (v *Views) fetch(src *Source, out interface{}) (bool, error) {
+	switch src.Schema {
+	case SchemaYAML:
+		return true, parseFromYAML(src.Path, out)
+	case SchemaJSON:
+		return true, parseFromJSON(src.Path, out)
+	case SchemaHTTP:
+		return v.parseFromHTTP(src, out)
+	case SchemaEtcd:
+		return v.parseFromEtcd(src, out)
+	case SchemaConsul:
+		return v.parseFromConsul(src, out)
+	case SchemaS3:
+		return v.parseFromS3(src, out)
+	}
+	return false, fmt.Errorf("unknown schema: %s", src.Schema)
+}
+
+// resetEntries empty the entries of the document out
+func resetEntries(out interface{}) {
+	slice := reflect.ValueOf(out.(rawDocument).entries()).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+}
+
+// appendEntry decode a single client or view in JSON or YAML and append it into the entries of the document out,
+// it is used by the sources storing an entry per key
+func appendEntry(out interface{}, data []byte) error {
+	slice := reflect.ValueOf(out.(rawDocument).entries()).Elem()
+	elem := reflect.New(slice.Type().Elem())
+	if err := yaml.Unmarshal(data, elem.Interface()); err != nil {
+		return err
+	}
+	slice.Set(reflect.Append(slice, elem.Elem()))
+	return nil
+}
+
+// parseFromYAML decode the YAML source into out, the source is either a file, a directory holding
+// the YAML files or a glob pattern, the entries of several files are concatenated in the file name order
+// and an entry declared in several files is taken from the last one
+func parseFromYAML(path string, out interface{}) error {
+	files, err := yamlFiles(path)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 1 {
+		return decodeYAMLFile(files[0], out)
+	}
+
+	doc, ok := out.(rawDocument)
+	if !ok {
+		return fmt.Errorf("a single YAML file is required: %s", path)
+	}
+	entries := reflect.ValueOf(doc.entries()).Elem()
+	entries.Set(reflect.MakeSlice(entries.Type(), 0, 0))
+
+	origins := make(map[string]string)
+	index := make(map[string]int)
+	for _, file := range files {
+		part := reflect.New(reflect.TypeOf(out).Elem()).Interface().(rawDocument)
+		if err := decodeYAMLFile(file, part); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+
+		if *part.version() > *doc.version() {
+			*doc.version() = *part.version()
+		}
+
+		partEntries := reflect.ValueOf(part.entries()).Elem()
+		for i, name := range part.names() {
+			if prev, ok := origins[name]; ok {
+				log.Warningf("(%s) is declared in both %s and %s, using the one from %s", name, prev, file, file)
+				entries.Index(index[name]).Set(partEntries.Index(i))
+			} else {
+				index[name] = entries.Len()
+				entries.Set(reflect.Append(entries, partEntries.Index(i)))
+			}
+			origins[name] = file
+		}
+	}
+
+	return nil
+}
+
+// yamlFiles return the files of the YAML source ordered by the file name,
+// a glob pattern or a directory is required to match at least a file
+func yamlFiles(path string) ([]string, error) {
+	patterns := yamlPatterns(path)
+	if len(patterns) == 1 && patterns[0] == path && !isGlob(path) {
+		return []string{path}, nil
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no YAML file is found: %s", path)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// yamlPatterns return the glob patterns of the files of the YAML source,
+// a directory is expanded to the YAML files directly under it
+func yamlPatterns(path string) []string {
+	if isDir(path) {
+		return []string{filepath.Join(path, "*.yaml"), filepath.Join(path, "*.yml")}
+	}
+	return []string{path}
+}
+
+func decodeYAMLFile(filename string, out interface{}) error {
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	err = yaml.Unmarshal([]byte(expandEnv(filename, string(file))), out)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// envRef is the ${VAR} and $VAR references to the environment variables
+var envRef = regexp.MustCompile(`\$\{([^}]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// expandEnv expand the ${VAR} and $VAR references of the file content from the environment,
+// the missing variables are expanded to empty with a warning, while the other uses of $
+// which are not a reference to a variable name (e.g. $1 or ${1} of a regexp) are kept as is
+func expandEnv(filename, content string) string {
+	missing := make(map[string]bool)
+	return envRef.ReplaceAllStringFunc(content, func(ref string) string {
+		name := ref[1:]
+		if strings.HasPrefix(name, "{") {
+			name = name[1 : len(name)-1]
+		}
+		if !isEnvName(name) {
+			return ref
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok && !missing[name] {
+			log.Warningf("environment variable %s referenced by %s is not set, expanding it to empty", name, filename)
+			missing[name] = true
+		}
+		return value
+	})
+}
+
+// isEnvName report whether the name is a valid environment variable name
+func isEnvName(name string) bool {
+	for i, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// isGlob report whether the path holds any of the glob pattern characters
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// isDir report whether the path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func parseFromJSON(filename string, out interface{}) error {
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(file, out)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseFromHTTP decode the HTTP source into out, the fetched body is written into the cache file of the source
+// if any, which is loaded instead when the source is unreachable before its first load
+func (v *Views) parseFromHTTP(src *Source, out interface{}) (bool, error) {
+	modified, body, err := v.fetchHTTP(src, out)
+	if err != nil {
+		if src.CacheFile == "" || src.loaded || v.ctx.Err() != nil {
+			return false, err
+		}
+
+		log.Warningf("failed to fetch %s, loading its cache file %s: %v", src.Path, src.CacheFile, err)
+		if cerr := parseFromJSON(src.CacheFile, out); cerr != nil {
+			return false, fmt.Errorf("%v, and failed to load its cache file: %v", err, cerr)
+		}
+		src.loaded = true
+		return true, nil
+	}
+	src.loaded = true
+
+	if modified && src.CacheFile != "" {
+		if err := writeFileAtomic(src.CacheFile, body); err != nil {
+			log.Warningf("failed to write the cache file of %s: %v", src.Path, err)
+		}
+	}
+	return modified, nil
+}
+
+// fetchHTTP fetch the HTTP source and decode it into out, it also returns the body of the document,
+// which is the combined pages encoded as a single document for the paginated source
+func (v *Views) fetchHTTP(src *Source, out interface{}) (modified bool, body []byte, err error) {
+	client := &http.Client{
+		Timeout:   v.HTTPTimeout,
+		Transport: src.httpTransport(),
+	}
+
+	resp, err := v.getHTTP(client, src, src.Path, true)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && src.cache != nil:
+		body = src.cache.Body
+	case resp.StatusCode == http.StatusOK:
+		body, err = readBody(resp)
+		if err != nil {
+			return
+		}
+		modified = true
+	default:
+		err = fmt.Errorf("unexpected response status: %s", resp.Status)
+		return
+	}
+
+	if modified {
+		var next string
+		next, err = nextLink(resp)
+		if err != nil {
+			return
+		}
+		if next != "" {
+			// the paginated source is never cached, as its first page tells nothing about the others
+			src.cache = nil
+			if err = v.parsePages(client, src, body, next, out); err != nil {
+				return
+			}
+			body, err = json.Marshal(out)
+			return
+		}
+	}
+
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return
+	}
+
+	if modified {
+		src.cache = nil
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			src.cache = &httpCache{
+				ETag:         etag,
+				LastModified: lastModified,
+				Body:         body,
+			}
+		}
+	}
+	return
+}
+
+// parsePages decode the paginated HTTP source into out, following the next links from the first page body
+// up to httpMaxPages, the entries of every page are concatenated in the page order
+func (v *Views) parsePages(client *http.Client, src *Source, body []byte, next string, out interface{}) error {
+	doc, ok := out.(rawDocument)
+	if !ok {
+		return fmt.Errorf("a single page is required: %s", src.Path)
+	}
+	entries := reflect.ValueOf(doc.entries()).Elem()
+	entries.Set(reflect.MakeSlice(entries.Type(), 0, 0))
+
+	target := src.Path
+	for page := 1; ; page++ {
+		part := reflect.New(reflect.TypeOf(out).Elem()).Interface().(rawDocument)
+		if err := json.Unmarshal(body, part); err != nil {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+
+		if *part.version() > *doc.version() {
+			*doc.version() = *part.version()
+		}
+		entries.Set(reflect.AppendSlice(entries, reflect.ValueOf(part.entries()).Elem()))
+
+		if next == "" {
+			return nil
+		}
+		if page >= httpMaxPages {
+			return fmt.Errorf("more than %d pages are found: %s", httpMaxPages, src.Path)
+		}
+
+		target = next
+		resp, err := v.getHTTP(client, src, target, false)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected response status of %s: %s", target, resp.Status)
+		}
+
+		body, err = readBody(resp)
+		if err == nil {
+			next, err = nextLink(resp)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+	}
+}
+
+// nextLink return the URL of the next page given by the RFC 5988 Link header of the response, e.g.
+//
+//	Link: <https://api.example.com/records?page=2>; rel="next"
+//
+// it is resolved against the requested URL and must be on the same origin, so the credentials
+// of the source are never sent elsewhere, an empty URL is returned on the last page
+func nextLink(resp *http.Response) (string, error) {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			params := strings.Split(link, ";")
+			ref := strings.TrimSpace(params[0])
+			if !strings.HasPrefix(ref, "<") || !strings.HasSuffix(ref, ">") || !isNextRel(params[1:]) {
+				continue
+			}
+
+			base := resp.Request.URL
+			u, err := base.Parse(strings.Trim(ref, "<>"))
+			if err != nil {
+				return "", fmt.Errorf("invalid next link %s: %v", ref, err)
+			}
+			if u.Scheme != base.Scheme || u.Host != base.Host {
+				return "", fmt.Errorf("next link %s is not on the origin of %s", u, base)
+			}
+			return u.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// isNextRel report whether any of the link params is the relation of the next page,
+// the relation may hold several types separated by a space, e.g. rel="next last"
+func isNextRel(params []string) bool {
+	for _, param := range params {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+			continue
+		}
+		for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+			if strings.EqualFold(rel, "next") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getHTTP send the GET request to the target URL of the HTTP source, retrying it on the transient failures
+func (v *Views) getHTTP(client *http.Client, src *Source, target string, conditional bool) (resp *http.Response, err error) {
+	for attempt := 0; ; attempt++ {
+		resp, err = v.doHTTP(client, src, target, conditional)
+		if !isRetryable(resp, err) || attempt >= v.HTTPRetries || v.ctx.Err() != nil {
+			return
+		}
+
+		reason := err
+		if resp != nil {
+			reason = fmt.Errorf("unexpected response status: %s", resp.Status)
+			resp.Body.Close()
+		}
+
+		wait := backoff(attempt)
+		log.Warningf("failed to fetch %s (attempt %d of %d), retrying in %s: %v", target, attempt+1, v.HTTPRetries+1, wait, reason)
+		select {
+		case <-time.After(wait):
+		case <-v.ctx.Done():
+			return nil, v.ctx.Err()
+		}
+	}
+}
+
+// doHTTP send a single GET request to the target URL of the HTTP source,
+// the cached validators are only sent with the conditional request
+func (v *Views) doHTTP(client *http.Client, src *Source, target string, conditional bool) (*http.Response, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		v.ctx,
+		http.MethodGet,
+		u.String(),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range src.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	if src.Username != "" || src.Password != "" {
+		req.SetBasicAuth(src.Username, src.Password)
+	}
+
+	if src.BearerTokenEnv != "" {
+		token := os.Getenv(src.BearerTokenEnv)
+		if token == "" {
+			log.Warningf("environment variable %s of bearer token is empty", src.BearerTokenEnv)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	if conditional && src.cache != nil {
+		if src.cache.ETag != "" {
+			req.Header.Set("If-None-Match", src.cache.ETag)
+		}
+		if src.cache.LastModified != "" {
+			req.Header.Set("If-Modified-Since", src.cache.LastModified)
+		}
+	}
+
+	req.Header.Set("Accept-Encoding", "gzip")
+	setUserAgent(req, v.HTTPUserAgent)
+
+	return client.Do(req)
+}
+
+// expandUserAgent replace the {host} placeholder of the User-Agent with the hostname,
+// so each instance is told apart by the server, e.g. "coredns-views/1.0 host={host}"
+func expandUserAgent(ua string) (string, error) {
+	if !strings.Contains(ua, "{host}") {
+		return ua, nil
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the hostname of http_user_agent: %v", err)
+	}
+	return strings.Replace(ua, "{host}", host, -1), nil
+}
+
+// setUserAgent set the User-Agent of the request unless it is given by the header option of the source
+func setUserAgent(req *http.Request, ua string) {
+	if ua != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", ua)
+	}
+}
+
+// httpTransport return the transport of the HTTPS, Consul and S3 source with its TLS config,
+// which is rebuilt once any of the certificate files is modified so they can be rotated without restart,
+// the previous TLS config is kept when the modified files are not valid yet
+func (src *Source) httpTransport() http.RoundTripper {
+	if src.TLSConfig == nil {
+		return http.DefaultTransport
+	}
+
+	if modTime := latestModTime(src.tlsFiles); modTime.After(src.tlsModTime) {
+		tlsConfig, err := mwtls.NewTLSConfigFromArgs(src.tlsFiles...)
+		if err != nil {
+			log.Warningf("failed to reload TLS certificates of %s, keeping the previous ones: %v", src.Path, err)
+		} else {
+			log.Infof("TLS certificates of %s are reloaded", src.Path)
+			tlsConfig.InsecureSkipVerify = src.InsecureSkipVerify
+			src.TLSConfig, src.tlsModTime = tlsConfig, modTime
+			if src.transport != nil {
+				src.transport.CloseIdleConnections()
+				src.transport = nil
+			}
+		}
+	}
+
+	if src.transport == nil {
+		src.transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: src.TLSConfig,
+		}
+	}
+	return src.transport
+}
+
+// latestModTime return the latest modification time of the files, the missing files are ignored
+func latestModTime(files []string) time.Time {
+	var latest time.Time
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// writeFileAtomic write the data into the file through a temporary file renamed over it,
+// so the file is never left partially written
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// readBody read the whole response body, decompressing it when the server sends it gzip-encoded
+func readBody(resp *http.Response) ([]byte, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	return ioutil.ReadAll(gz)
+}
+
+// isRetryable report whether the HTTP fetch is worth to be retried,
+// which is on network errors, server errors and rate limited responses
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// backoff return the jittered exponential wait time before the next attempt
+func backoff(attempt int) time.Duration {
+	d := httpRetryBackoff << uint(attempt)
+	if d <= 0 || d > httpRetryMaxBackoff {
+		d = httpRetryMaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func schemaCheck(str string) (string, error) {
+	if strings.HasPrefix(str, "http://") || strings.HasPrefix(str, "https://") {
+		return SchemaHTTP, nil
+	} else if strings.HasPrefix(str, "etcd://") {
+		return SchemaEtcd, nil
+	} else if strings.HasPrefix(str, "consul://") {
+		return SchemaConsul, nil
+	} else if strings.HasPrefix(str, "s3://") {
+		return SchemaS3, nil
+	} else if strings.HasSuffix(str, ".yaml") || strings.HasSuffix(str, ".yml") {
+		return SchemaYAML, nil
+	} else if strings.HasSuffix(str, ".json") {
+		return SchemaJSON, nil
+	} else if isDir(str) {
+		return SchemaYAML, nil
+	}
+	return "", fmt.Errorf("unknown schema: %s", str)
+}
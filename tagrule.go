@@ -0,0 +1,116 @@
+package views
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// TagRuleRegex represent of the tag rule matching the tag with a regular expression,
+	// its view may refer to the submatches of the expression, e.g. dc-$1
+	TagRuleRegex = "regex"
+	// TagRuleSuffix represent of the tag rule matching the tag by its suffix
+	TagRuleSuffix = "suffix"
+)
+
+// TagRule represent of the rule mapping the tags of the clients fetched from an external feed (e.g. IPAM)
+// into the view name, the client is named after the first rule that matches any of its tags
+type TagRule struct {
+	Kind    string
+	Pattern string
+	View    string
+
+	re *regexp.Regexp
+}
+
+// parseTagRule parse the tag rule of the source option, e.g.
+//
+//	tag_rule regex ^site-(\w+)$ dc-$1
+//	tag_rule suffix -internal internal
+func parseTagRule(args []string) (TagRule, error) {
+	if len(args) != 3 {
+		return TagRule{}, fmt.Errorf("tag_rule requires the kind, pattern and view")
+	}
+
+	rule := TagRule{Kind: args[0], Pattern: args[1], View: args[2]}
+	switch rule.Kind {
+	case TagRuleRegex:
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return TagRule{}, fmt.Errorf("invalid tag_rule pattern %q: %v", rule.Pattern, err)
+		}
+		rule.re = re
+	case TagRuleSuffix:
+	default:
+		return TagRule{}, fmt.Errorf("unknown tag_rule kind: %s", rule.Kind)
+	}
+	return rule, nil
+}
+
+// match return the view name of the tag, it also reports whether the tag is matched to the rule
+func (r TagRule) match(tag string) (string, bool) {
+	switch r.Kind {
+	case TagRuleRegex:
+		m := r.re.FindStringSubmatchIndex(tag)
+		if m == nil {
+			return "", false
+		}
+		return string(r.re.ExpandString(nil, r.View, tag, m)), true
+	case TagRuleSuffix:
+		return r.View, strings.HasSuffix(tag, r.Pattern)
+	}
+	return "", false
+}
+
+// applyTagRules name the clients as of the first rule matching any of their tags, then merge the clients
+// of the same name in order, the client matched to no rule keeps its name or is dropped when it has none
+func applyTagRules(rules []TagRule, clients []RawClientACL) []RawClientACL {
+	if len(rules) == 0 {
+		return clients
+	}
+
+	var (
+		merged []RawClientACL
+		index  = make(map[string]int)
+	)
+	for _, client := range clients {
+		if view, ok := tagView(rules, client.Tags); ok {
+			client.Name = view
+		}
+		if client.Name == "" {
+			log.Warningf("client with prefixes %v is dropped as none of its tags %v is matched", client.CIDRPrefixes, client.Tags)
+			continue
+		}
+
+		i, ok := index[client.Name]
+		if !ok {
+			index[client.Name] = len(merged)
+			merged = append(merged, client)
+			continue
+		}
+
+		m := &merged[i]
+		m.CIDRPrefixes = append(m.CIDRPrefixes, client.CIDRPrefixes...)
+		m.Hostnames = append(m.Hostnames, client.Hostnames...)
+		m.ServerCIDRs = append(m.ServerCIDRs, client.ServerCIDRs...)
+		m.Tags = append(m.Tags, client.Tags...)
+		if m.Canary == nil {
+			m.Canary = client.Canary
+		}
+	}
+
+	return merged
+}
+
+// tagView return the view name of the first rule matching any of the tags
+func tagView(rules []TagRule, tags []string) (string, bool) {
+	for _, rule := range rules {
+		for _, tag := range tags {
+			if view, ok := rule.match(tag); ok {
+				return view, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,163 @@
+package views
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// transferBatch is the number of records sent on every envelope of the transfer
+const transferBatch = 500
+
+// transfer answer the AXFR query with the records of the view, the IXFR query is
+// answered with a full transfer as the views do not keep any history of the records
+func (v *Views) transfer(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request, snap *snapshot, view string) (int, error) {
+	key, code := v.verifyTSIG(ctx, w, r)
+	if code != dns.RcodeSuccess {
+		log.Warningf("(%s) refused transfer of zone %q to %s with TSIG error %s", view, state.QName(), state.IP(), dns.RcodeToString[int(code)])
+		tsigError(w, r, code)
+		return dns.RcodeNotAuth, nil
+	}
+	if key != nil {
+		// every reply of the signed transfer is signed, including the refused ones
+		w = newTSIGWriter(w, r)
+	}
+
+	if !v.transferAllowed(state, key) {
+		log.Warningf("(%s) refused transfer of zone %q to %s", view, state.QName(), state.IP())
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		if err := w.WriteMsg(m); err != nil {
+			log.Error(err)
+		}
+		return dns.RcodeRefused, nil
+	}
+
+	apex := plugin.Zones(v.Zones).Matches(state.Name())
+	if apex == "" || apex != state.Name() {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNotAuth)
+		if err := w.WriteMsg(m); err != nil {
+			log.Error(err)
+		}
+		return dns.RcodeNotAuth, nil
+	}
+
+	zones := snap.clientZones[view]
+
+	soa := zones.soa(apex)
+
+	// the transfer is not possible over UDP, so the SOA alone is answered to the IXFR query
+	// which make the secondary retry over TCP, as described on RFC 1995
+	if state.Proto() != "tcp" {
+		if state.QType() != dns.TypeIXFR {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			if err := w.WriteMsg(m); err != nil {
+				log.Error(err)
+			}
+			return dns.RcodeRefused, nil
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		m.Answer = []dns.RR{soa}
+		if err := w.WriteMsg(m); err != nil {
+			log.Error(err)
+		}
+		return dns.RcodeSuccess, nil
+	}
+
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := tr.Out(w, r, ch); err != nil {
+			log.Errorf("(%s) failed to transfer zone %q to %s: %s", view, apex, state.IP(), err)
+		}
+	}()
+
+	rrs := []dns.RR{soa}
+	l := 0
+	for _, rr := range zones.records(apex) {
+		rrs = append(rrs, rr)
+		if len(rrs) >= transferBatch {
+			ch <- &dns.Envelope{RR: rrs}
+			l += len(rrs)
+			rrs = []dns.RR{}
+		}
+	}
+	rrs = append(rrs, soa)
+	ch <- &dns.Envelope{RR: rrs}
+	l += len(rrs)
+
+	close(ch)
+	wg.Wait()
+
+	log.Infof("(%s) outgoing transfer of %d records of zone %q to %s for %d SOA serial", view, l, apex, state.IP(), soa.Serial)
+	return dns.RcodeSuccess, nil
+}
+
+// transferAllowed report whether the query comes from one of the allowed transfer sources,
+// when the transfer keys are given the query is also required to be signed by one of them,
+// then it is allowed from anywhere unless the transfer sources are also given
+func (v *Views) transferAllowed(state request.Request, key *TransferKey) bool {
+	if len(v.TransferKeys) > 0 {
+		if key == nil {
+			return false
+		}
+		if len(v.TransferTo) == 0 {
+			return true
+		}
+	}
+
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return false
+	}
+
+	return netsContain(v.TransferTo, ip)
+}
+
+// records return a copy of every record of the view which is within the apex,
+// ordered by the name and type so the transfer is stable between the queries
+func (zs Zones) records(apex string) []dns.RR {
+	names := make([]string, 0, len(zs.Names))
+	for _, name := range zs.Names {
+		if dns.IsSubDomain(apex, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var rrs []dns.RR
+	for _, name := range names {
+		node := zs.Z[name]
+
+		qtypes := make([]int, 0, len(node))
+		for qtype := range node {
+			if qtype != dns.TypeSOA {
+				qtypes = append(qtypes, int(qtype))
+			}
+		}
+		sort.Ints(qtypes)
+
+		for _, qtype := range qtypes {
+			for _, z := range node[uint16(qtype)] {
+				rrs = append(rrs, dns.Copy(z.RR))
+			}
+		}
+	}
+
+	return rrs
+}
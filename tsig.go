@@ -0,0 +1,225 @@
+package views
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// TransferKey represent of the TSIG key authenticating the zone transfers
+type TransferKey struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+// tsigAlgorithms is the TSIG algorithms supported for the transfer keys
+var tsigAlgorithms = map[string]bool{
+	dns.HmacSHA1:   true,
+	dns.HmacSHA224: true,
+	dns.HmacSHA256: true,
+	dns.HmacSHA384: true,
+	dns.HmacSHA512: true,
+}
+
+// parseTransferKey parse the TSIG key of the transfer block, e.g.
+//
+//	transfer to 10.0.0.2 {
+//	    listen :5353
+//	    key transfer.example.internal hmac-sha256 c2VjcmV0LWtleS1vZi10aGUtdHJhbnNmZXI=
+//	}
+func parseTransferKey(args []string) (TransferKey, error) {
+	if len(args) != 3 {
+		return TransferKey{}, fmt.Errorf("key requires the name, algorithm and secret")
+	}
+
+	key := TransferKey{
+		Name:      dns.CanonicalName(args[0]),
+		Algorithm: dns.CanonicalName(args[1]),
+		Secret:    args[2],
+	}
+	if !tsigAlgorithms[key.Algorithm] {
+		return TransferKey{}, fmt.Errorf("unsupported key algorithm: %s", args[1])
+	}
+	if _, err := base64.StdEncoding.DecodeString(key.Secret); err != nil {
+		return TransferKey{}, fmt.Errorf("key secret of %s must be base64-encoded: %v", args[0], err)
+	}
+	return key, nil
+}
+
+// parseTransferBlock parse the optional block of the transfer directive following its sources,
+// the signed transfers are only served on the listen address of the transfer listener
+func (v *Views) parseTransferBlock(c *caddy.Controller) error {
+	if !c.NextArg() {
+		return nil
+	}
+	if c.Val() != "{" {
+		return c.ArgErr()
+	}
+
+	for c.Next() {
+		if c.Val() == "}" {
+			return nil
+		}
+
+		option := c.Val()
+		args := c.RemainingArgs()
+		switch option {
+		case "key":
+			key, err := parseTransferKey(args)
+			if err != nil {
+				return err
+			}
+			if v.TransferKeys == nil {
+				v.TransferKeys = make(map[string]TransferKey)
+			}
+			v.TransferKeys[key.Name] = key
+		case "listen":
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+			v.TransferListen = args[0]
+		default:
+			return fmt.Errorf("unknown transfer option: %s", option)
+		}
+	}
+	return c.EOFErr()
+}
+
+// transferListenerKey is the context key of the queries served by the transfer listener
+type transferListenerKey struct{}
+
+// startTransfer start the transfer listener, which server is given the transfer keys so the TSIG of the requests
+// is verified on the received message and the replies are signed, as the server of CoreDNS knows no key
+func (v *Views) startTransfer() error {
+	ln, err := net.Listen("tcp", v.TransferListen)
+	if err != nil {
+		return err
+	}
+
+	secrets := make(map[string]string, len(v.TransferKeys))
+	for name, key := range v.TransferKeys {
+		secrets[name] = key.Secret
+	}
+
+	v.transferServer = &dns.Server{Listener: ln, Net: "tcp", TsigSecret: secrets, Handler: dns.HandlerFunc(v.serveTransfer)}
+	go func() {
+		if err := v.transferServer.ActivateAndServe(); err != nil && !isClosedErr(err) {
+			log.Error(err)
+		}
+	}()
+
+	log.Infof("transfer listener is listening on %s", ln.Addr().String())
+	return nil
+}
+
+// stopTransfer stop the transfer listener when it is started
+func (v *Views) stopTransfer() error {
+	if v.transferServer == nil {
+		return nil
+	}
+
+	err := v.transferServer.Shutdown()
+	v.transferServer = nil
+	return err
+}
+
+// serveTransfer answer the queries of the transfer listener, which only serves the transfers,
+// the replies bypass the truncation of the scrub writer, which is never needed over TCP
+func (v *Views) serveTransfer(w dns.ResponseWriter, r *dns.Msg) {
+	code := dns.RcodeRefused
+	if len(r.Question) > 0 {
+		if qtype := r.Question[0].Qtype; qtype == dns.TypeAXFR || qtype == dns.TypeIXFR {
+			ctx := context.WithValue(v.ctx, transferListenerKey{}, true)
+			code, _ = v.ServeDNS(ctx, w, r)
+		}
+	}
+	if plugin.ClientWrite(code) {
+		return
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(r, code)
+	if err := w.WriteMsg(m); err != nil {
+		log.Error(err)
+	}
+}
+
+// verifyTSIG verify the TSIG of the transfer request with the transfer keys, it returns the key
+// which signs the request, or nil when the request is not signed, along with the TSIG error code
+// of the request which fails the verification, the TSIG is verified on the received message by the server
+// of the transfer listener, so the signed request coming to the server of CoreDNS is answered with BADKEY
+func (v *Views) verifyTSIG(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (*TransferKey, uint16) {
+	t := r.IsTsig()
+	if t == nil {
+		return nil, dns.RcodeSuccess
+	}
+
+	key, ok := v.TransferKeys[dns.CanonicalName(t.Hdr.Name)]
+	if !ok || dns.CanonicalName(t.Algorithm) != key.Algorithm {
+		return nil, dns.RcodeBadKey
+	}
+	if ctx.Value(transferListenerKey{}) == nil {
+		log.Warningf("signed transfer is only served on the transfer listener: %s", v.TransferListen)
+		return nil, dns.RcodeBadKey
+	}
+
+	switch w.TsigStatus() {
+	case nil:
+		return &key, dns.RcodeSuccess
+	case dns.ErrSecret:
+		return nil, dns.RcodeBadKey
+	case dns.ErrTime:
+		return nil, dns.RcodeBadTime
+	}
+	return nil, dns.RcodeBadSig
+}
+
+// tsigError answer the request failing the TSIG verification with NOTAUTH along with the unsigned TSIG
+// holding the error code, as described on RFC 8945, it is written as is so the server never signs it
+func tsigError(w dns.ResponseWriter, r *dns.Msg, code uint16) {
+	t := r.IsTsig()
+
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeNotAuth)
+	m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+	m.IsTsig().Error = code
+	if code == dns.RcodeBadTime {
+		m.IsTsig().TimeSigned = t.TimeSigned
+	}
+
+	data, err := m.Pack()
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// tsigWriter add the TSIG RR to the replies to the signed request, so they are signed by the server
+// of the transfer listener, the first reply covers the MAC of the request and each of the following
+// replies covers the MAC of the previous one
+type tsigWriter struct {
+	dns.ResponseWriter
+	request *dns.TSIG
+}
+
+// newTSIGWriter return the writer signing the replies to the signed request
+func newTSIGWriter(w dns.ResponseWriter, r *dns.Msg) *tsigWriter {
+	return &tsigWriter{ResponseWriter: w, request: r.IsTsig()}
+}
+
+// WriteMsg implements the dns.ResponseWriter interface
+func (w *tsigWriter) WriteMsg(m *dns.Msg) error {
+	if m.IsTsig() == nil {
+		m.SetTsig(w.request.Hdr.Name, w.request.Algorithm, w.request.Fudge, time.Now().Unix())
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
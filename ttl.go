@@ -0,0 +1,65 @@
+package views
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TTL represent of the record TTL in seconds, which is given either as the number of seconds
+// or as a duration string, e.g. 300 or 5m
+type TTL uint32
+
+// UnmarshalYAML decode the TTL from either the number of seconds or a duration string
+func (t *TTL) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var seconds uint32
+	if err := unmarshal(&seconds); err == nil {
+		*t = TTL(seconds)
+		return nil
+	}
+
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return fmt.Errorf("invalid ttl: expected the number of seconds or a duration string")
+	}
+	return t.parse(s)
+}
+
+// UnmarshalJSON decode the TTL from either the number of seconds or a duration string
+func (t *TTL) UnmarshalJSON(data []byte) error {
+	var seconds uint32
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*t = TTL(seconds)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid ttl %s: expected the number of seconds or a duration string", data)
+	}
+	return t.parse(s)
+}
+
+// parse set the TTL from the string, which is the number of seconds when it holds the digits alone
+func (t *TTL) parse(s string) error {
+	s = strings.TrimSpace(s)
+
+	if seconds, err := strconv.ParseUint(s, 10, 32); err == nil {
+		*t = TTL(seconds)
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid ttl %q: %v", s, err)
+	}
+	if d < 0 || d.Seconds() > math.MaxUint32 {
+		return fmt.Errorf("invalid ttl %q: out of range", s)
+	}
+
+	*t = TTL(d / time.Second)
+	return nil
+}
@@ -3,9 +3,12 @@ package views
 import (
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/miekg/dns"
 )
 
@@ -14,12 +17,49 @@ type (
 	ClientACL struct {
 		Name     string
 		CIDRNets []*net.IPNet
+		// ServerNets is the local addresses which receive the queries of the client, when it is given
+		// the client is only matched to the queries received on those, regardless of the user IP
+		// when the client has no CIDR prefix, the local address is the one of the listener so the server
+		// needs to be bound to each of the addresses (e.g. with the bind plugin) rather than the wildcard
+		ServerNets []*net.IPNet
+		// Disabled tells the client is skipped on matching while its config is kept
+		Disabled bool
+		// Canary routes the share of the clients to the alternate view, nil means every client goes to its view
+		Canary *Canary
 	}
 
-	// Zones represent list of zones available
+	// Zones represent list of zones available, keyed by name and then by type
 	Zones struct {
-		Z     map[string]Zone
+		Z     map[string]map[uint16][]Zone
 		Names []string
+
+		// SOA is the SOA record of the view without the owner name,
+		// it is nil when the view does not declare one then the default is used
+		SOA    *dns.SOA
+		Serial uint32
+
+		// MinTTL and MaxTTL override the TTL range of the plugin for the view, zero means unset
+		MinTTL uint32
+		MaxTTL uint32
+
+		// Upstream is the resolvers of the names which are out of the zones of the view
+		Upstream []string
+
+		// Parent is the view which answers the names that do not exist in the view on every query
+		Parent string
+
+		// AllowTypes is the only query types answered by the view when it is given,
+		// and DenyTypes is the query types refused by the view
+		AllowTypes map[uint16]bool
+		DenyTypes  map[uint16]bool
+
+		// MatchNames is the name patterns of the queries answered by the view regardless of the client,
+		// as of the name precedence of the plugin
+		MatchNames []string
+
+		// ents is the empty non-terminals of the names, which is precomputed before the view is served,
+		// it is nil until then and the names are scanned instead
+		ents map[string]bool
 	}
 
 	// Zone represent of single zone record definition
@@ -28,17 +68,27 @@ type (
 		TTL   uint32
 		Type  uint16
 		Value string
+		RR    dns.RR
+
+		// Weight is the chance of the record to be picked among the weighted records of the same name and type,
+		// nil means the record is not weighted and it is always answered
+		Weight *uint32
+		// Order is the position of the record in the answers among the records of the same name and type,
+		// nil means the record follows the ordered ones in the config order
+		Order *int
+		// Meta is the annotations of the record (e.g. its owner) exposed by the admin endpoint, never served
+		Meta map[string]string
 	}
 
 	// SOA represent of SOA record
 	SOA struct {
-		MName            string
-		RName            string
-		Serial           uint
-		Refresh          uint16
-		Retry            uint16
-		Expire           uint32
-		NegativeCacheTTL uint16
+		MName            string `yaml:"mname" json:"mname"`
+		RName            string `yaml:"rname" json:"rname"`
+		Serial           uint   `yaml:"serial" json:"serial"`
+		Refresh          uint16 `yaml:"refresh" json:"refresh"`
+		Retry            uint16 `yaml:"retry" json:"retry"`
+		Expire           uint32 `yaml:"expire" json:"expire"`
+		NegativeCacheTTL uint16 `yaml:"negative_cache_ttl" json:"negative_cache_ttl"`
 	}
 
 	// Record represent of single record on origin
@@ -54,20 +104,50 @@ type (
 	RawClientACL struct {
 		Name         string   `yaml:"name" json:"name"`
 		CIDRPrefixes []string `yaml:"prefixes" json:"prefixes"`
+		// Hostnames is resolved into the single host prefixes of its addresses on every reload
+		Hostnames []string `yaml:"hostnames,omitempty" json:"hostnames,omitempty"`
+		// ServerCIDRs is the CIDR prefixes or IP addresses of the local addresses which receive the queries of the client
+		ServerCIDRs []string `yaml:"server_cidr,omitempty" json:"server_cidr,omitempty"`
+		// Tags is mapped into the client name by the tag rules of its source, if any
+		Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+		// Enabled tells whether the client is matched to its view, nil means it is enabled
+		Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+		// Canary is the share of the clients routed to the alternate view
+		Canary *RawCanary `yaml:"canary,omitempty" json:"canary,omitempty"`
 	}
 
 	// RawRecord represent specification of Record YAML-file
 	RawRecord struct {
-		Name    string          `yaml:"name" json:"name"`
-		Records []RawRecordUnit `yaml:"records" json:"records"`
+		Name    string   `yaml:"name" json:"name"`
+		Inherit []string `yaml:"inherit,omitempty" json:"inherit,omitempty"`
+		SOA     *SOA     `yaml:"soa,omitempty" json:"soa,omitempty"`
+		MinTTL  uint32   `yaml:"min_ttl,omitempty" json:"min_ttl,omitempty"`
+		MaxTTL  uint32   `yaml:"max_ttl,omitempty" json:"max_ttl,omitempty"`
+		// AllowTypes and DenyTypes is the query types allowed and refused by the view, e.g. [ANY, AXFR]
+		AllowTypes []string `yaml:"allow_types,omitempty" json:"allow_types,omitempty"`
+		DenyTypes  []string `yaml:"deny_types,omitempty" json:"deny_types,omitempty"`
+		// Upstream is the resolvers of the names which are out of the zones of the view
+		Upstream []string        `yaml:"upstream,omitempty" json:"upstream,omitempty"`
+		Records  []RawRecordUnit `yaml:"records" json:"records"`
+		// Parent is looked up on every query for the names which do not exist in the view,
+		// unlike Inherit the parent is never copied so it is updated independently
+		Parent string `yaml:"parent,omitempty" json:"parent,omitempty"`
+		// MatchNames is the name patterns of the queries served from the view, e.g. *.dev.example.com
+		MatchNames []string `yaml:"match_names,omitempty" json:"match_names,omitempty"`
 	}
 
 	// RawRecordUnit represent a smallest unit of Record YAML-file
 	RawRecordUnit struct {
-		Name  string `yaml:"name" json:"name"`
-		TTL   uint32 `yaml:"ttl" json:"ttl"`
-		Type  string `yaml:"type" json:"type"`
-		Value string `yaml:"value" json:"value"`
+		Name   string  `yaml:"name" json:"name"`
+		TTL    TTL     `yaml:"ttl" json:"ttl"`
+		Type   string  `yaml:"type" json:"type"`
+		Value  string  `yaml:"value" json:"value"`
+		Weight *uint32 `yaml:"weight,omitempty" json:"weight,omitempty"`
+		Order  *int    `yaml:"order,omitempty" json:"order,omitempty"`
+		// Meta is the annotations for the ops tooling, e.g. the owner team, which are never served in DNS
+		Meta map[string]string `yaml:"meta,omitempty" json:"meta,omitempty"`
+		// Enabled tells whether the record is served by its view, nil means it is enabled
+		Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
 	}
 )
 
@@ -84,6 +164,18 @@ const (
 	TypeSOA = "SOA"
 	// TypeNS represent of DNS RR of NS
 	TypeNS = "NS"
+	// TypeMX represent of DNS RR of MX
+	TypeMX = "MX"
+	// TypeSRV represent of DNS RR of SRV
+	TypeSRV = "SRV"
+	// TypePTR represent of DNS RR of PTR
+	TypePTR = "PTR"
+	// TypeDNAME represent of DNS RR of DNAME
+	TypeDNAME = "DNAME"
+	// TypeCAA represent of DNS RR of CAA
+	TypeCAA = "CAA"
+	// TypeNAPTR represent of DNS RR of NAPTR
+	TypeNAPTR = "NAPTR"
 
 	// ClassINET represent of DNS RR Class of IN
 	ClassINET = "IN"
@@ -91,32 +183,591 @@ const (
 	// SchemaYAML represent of YAML schema
 	SchemaYAML = "yaml"
 
+	// SchemaJSON represent of JSON schema
+	SchemaJSON = "json"
+
 	// SchemaHTTP represent of HTTP schema
 	SchemaHTTP = "http"
+
+	// SchemaEtcd represent of etcd schema
+	SchemaEtcd = "etcd"
+
+	// SchemaConsul represent of Consul KV schema
+	SchemaConsul = "consul"
+
+	// SchemaS3 represent of S3 (or S3-compatible) object schema
+	SchemaS3 = "s3"
+
+	// NoMatchRefuse represent of the policy refusing the unmatched clients
+	NoMatchRefuse = "refuse"
+
+	// NoMatchNXDomain represent of the policy answering NXDOMAIN to the unmatched clients
+	NoMatchNXDomain = "nxdomain"
+
+	// NoMatchFallthrough represent of the policy passing the unmatched clients to the next plugin
+	NoMatchFallthrough = "fallthrough"
+
+	// NoMatchDefaultView represent of the policy answering the unmatched clients from the fallback view
+	NoMatchDefaultView = "default-view"
+)
+
+const (
+	defaultSOATTL     = 300
+	defaultSOARefresh = 7200
+	defaultSOARetry   = 1800
+	defaultSOAExpire  = 86400
+	defaultSOAMinTTL  = 30
+
+	// maxTXTString is the maximum length of a single character-string of TXT record
+	maxTXTString = 255
 )
 
+// NewSOA is method to create SOA record of a view from its SOA specification,
+// the unset timers are filled with the default values
+func NewSOA(soa SOA) (*dns.SOA, error) {
+	if soa.MName == "" || soa.RName == "" {
+		return nil, fmt.Errorf("both mname and rname are required for SOA")
+	}
+
+	rr := &dns.SOA{
+		Hdr:     dns.RR_Header{Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: defaultSOATTL},
+		Ns:      plugin.Host(soa.MName).Normalize(),
+		Mbox:    plugin.Host(soa.RName).Normalize(),
+		Serial:  uint32(soa.Serial),
+		Refresh: uint32(soa.Refresh),
+		Retry:   uint32(soa.Retry),
+		Expire:  soa.Expire,
+		Minttl:  uint32(soa.NegativeCacheTTL),
+	}
+
+	if rr.Refresh == 0 {
+		rr.Refresh = defaultSOARefresh
+	}
+	if rr.Retry == 0 {
+		rr.Retry = defaultSOARetry
+	}
+	if rr.Expire == 0 {
+		rr.Expire = defaultSOAExpire
+	}
+	if rr.Minttl == 0 {
+		rr.Minttl = defaultSOAMinTTL
+	}
+
+	return rr, nil
+}
+
 // NewZoneRecord is method to create new zone record from raw record unit
 func NewZoneRecord(record RawRecordUnit) (Zone, error) {
 	t := strings.ToUpper(record.Type)
-	var rrtype uint16
+	name := plugin.Host(record.Name).Normalize()
+
+	var (
+		rr    dns.RR
+		value = record.Value
+	)
 
 	switch t {
-	case "A":
-		rrtype = dns.TypeA
-	case "AAAA":
-		rrtype = dns.TypeAAAA
-	case "CNAME":
-		rrtype = dns.TypeCNAME
-	case "TXT":
-		rrtype = dns.TypeTXT
+	case TypeA:
+		ip := net.ParseIP(record.Value)
+		if ip == nil || ip.To4() == nil {
+			return Zone{}, fmt.Errorf("invalid value for A record %s: \"%s\"", record.Name, record.Value)
+		}
+		rr = &dns.A{A: ip.To4()}
+	case TypeAAAA:
+		ip := net.ParseIP(record.Value)
+		if ip == nil || ip.To4() != nil {
+			return Zone{}, fmt.Errorf("invalid value for AAAA record %s: \"%s\"", record.Name, record.Value)
+		}
+		rr = &dns.AAAA{AAAA: ip}
+	case TypeCNAME:
+		value = plugin.Host(record.Value).Normalize()
+		rr = &dns.CNAME{Target: value}
+	case TypeDNAME:
+		value = plugin.Host(record.Value).Normalize()
+		rr = &dns.DNAME{Target: value}
+	case TypeTXT:
+		rr = &dns.TXT{Txt: splitTXT(record.Value)}
+	case TypeMX:
+		mx, err := parseMX(record.Value)
+		if err != nil {
+			return Zone{}, fmt.Errorf("invalid value for MX record %s: %s", record.Name, err)
+		}
+		value = mx.Mx
+		rr = mx
+	case TypeSRV:
+		srv, err := parseSRV(record.Value)
+		if err != nil {
+			return Zone{}, fmt.Errorf("invalid value for SRV record %s: %s", record.Name, err)
+		}
+		value = srv.Target
+		rr = srv
+	case TypePTR:
+		rev, err := reverseName(record.Name)
+		if err != nil {
+			return Zone{}, fmt.Errorf("invalid name for PTR record %s: %s", record.Name, err)
+		}
+		name = rev
+		value = plugin.Host(record.Value).Normalize()
+		rr = &dns.PTR{Ptr: value}
+	case TypeNS:
+		value = plugin.Host(record.Value).Normalize()
+		rr = &dns.NS{Ns: value}
+	case TypeCAA:
+		caa, err := parseCAA(record.Value)
+		if err != nil {
+			return Zone{}, fmt.Errorf("invalid value for CAA record %s: %s", record.Name, err)
+		}
+		rr = caa
+	case TypeNAPTR:
+		naptr, err := parseNAPTR(record.Value)
+		if err != nil {
+			return Zone{}, fmt.Errorf("invalid value for NAPTR record %s: %s", record.Name, err)
+		}
+		value = naptr.Replacement
+		rr = naptr
 	default:
-		return Zone{}, fmt.Errorf("unknown type for record %s: \"%s\"", record.Name, t)
+		return Zone{}, &unknownTypeError{name: record.Name, rrtype: t}
 	}
 
+	rrtype := dns.StringToType[t]
+	*rr.Header() = dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: uint32(record.TTL)}
+
 	return Zone{
-		Name:  plugin.Host(record.Name).Normalize(),
-		TTL:   record.TTL,
-		Type:  rrtype,
-		Value: plugin.Host(record.Value).Normalize(),
+		Name:   name,
+		TTL:    uint32(record.TTL),
+		Type:   rrtype,
+		Value:  value,
+		RR:     rr,
+		Weight: record.Weight,
+		Order:  record.Order,
+		Meta:   record.Meta,
+	}, nil
+}
+
+// unknownTypeError represent of the error of the record which type is not supported
+type unknownTypeError struct {
+	name   string
+	rrtype string
+}
+
+func (e *unknownTypeError) Error() string {
+	return fmt.Sprintf("unknown type for record %s: \"%s\"", e.name, e.rrtype)
+}
+
+// droppedReason return the reason of the record dropped by the error
+func droppedReason(err error) string {
+	if _, ok := err.(*unknownTypeError); ok {
+		return droppedBadType
+	}
+	return droppedBadValue
+}
+
+// splitTXT split the TXT value into the character-strings of at most 255 bytes on the wire,
+// an escape sequence (\DDD or \X) is a single byte on the wire and is never split
+func splitTXT(value string) []string {
+	if len(value) <= maxTXTString {
+		return []string{value}
+	}
+
+	var (
+		chunks []string
+		start  int
+		n      int
+	)
+	for i := 0; i < len(value); n++ {
+		if n == maxTXTString {
+			chunks = append(chunks, value[start:i])
+			start, n = i, 0
+		}
+
+		switch {
+		case value[i] != '\\' || i+1 == len(value):
+			i++
+		case i+3 < len(value) && isDigit(value[i+1]) && isDigit(value[i+2]) && isDigit(value[i+3]):
+			i += 4
+		default:
+			i += 2
+		}
+	}
+
+	return append(chunks, value[start:])
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// parseCAA parse CAA value in form of "<flags> <tag> <value>", e.g. 0 issue "letsencrypt.org"
+func parseCAA(value string) (*dns.CAA, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected \"<flags> <tag> <value>\", got \"%s\"", value)
+	}
+
+	flag, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flags \"%s\"", fields[0])
+	}
+
+	tag := strings.ToLower(fields[1])
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return nil, fmt.Errorf("invalid tag \"%s\"", fields[1])
+		}
+	}
+
+	v := strings.Join(fields[2:], " ")
+	if strings.HasPrefix(v, "\"") {
+		if v, err = strconv.Unquote(v); err != nil {
+			return nil, fmt.Errorf("invalid quoted value %s", strings.Join(fields[2:], " "))
+		}
+	}
+
+	return &dns.CAA{
+		Flag:  uint8(flag),
+		Tag:   tag,
+		Value: v,
+	}, nil
+}
+
+// reverseName normalize the owner name of PTR record, it accepts either
+// an in-addr.arpa or ip6.arpa name, or an IP address which is converted to its reverse name
+func reverseName(name string) (string, error) {
+	if ip := net.ParseIP(name); ip != nil {
+		return dns.ReverseAddr(ip.String())
+	}
+
+	name = plugin.Name(name).Normalize()
+	switch {
+	case dns.IsSubDomain("in-addr.arpa.", name):
+		labels := dns.SplitDomainName(strings.TrimSuffix(name, "in-addr.arpa."))
+		if len(labels) == 0 || len(labels) > 4 {
+			return "", fmt.Errorf("expected 1 to 4 octets")
+		}
+		for _, label := range labels {
+			if _, err := strconv.ParseUint(label, 10, 8); err != nil {
+				return "", fmt.Errorf("invalid octet \"%s\"", label)
+			}
+		}
+	case dns.IsSubDomain("ip6.arpa.", name):
+		labels := dns.SplitDomainName(strings.TrimSuffix(name, "ip6.arpa."))
+		if len(labels) == 0 || len(labels) > 32 {
+			return "", fmt.Errorf("expected 1 to 32 nibbles")
+		}
+		for _, label := range labels {
+			if _, err := strconv.ParseUint(label, 16, 4); err != nil || len(label) != 1 {
+				return "", fmt.Errorf("invalid nibble \"%s\"", label)
+			}
+		}
+	default:
+		return "", fmt.Errorf("expected name under in-addr.arpa. or ip6.arpa.")
+	}
+
+	return name, nil
+}
+
+// parseMX parse MX value in form of "<preference> <exchange>"
+func parseMX(value string) (*dns.MX, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("expected \"<preference> <exchange>\", got \"%s\"", value)
+	}
+
+	pref, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid preference \"%s\"", fields[0])
+	}
+
+	return &dns.MX{
+		Preference: uint16(pref),
+		Mx:         plugin.Host(fields[1]).Normalize(),
+	}, nil
+}
+
+// parseSRV parse SRV value in form of "<priority> <weight> <port> <target>"
+func parseSRV(value string) (*dns.SRV, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("expected \"<priority> <weight> <port> <target>\", got \"%s\"", value)
+	}
+
+	var nums [3]uint16
+	for i, field := range fields[:3] {
+		n, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number \"%s\"", field)
+		}
+		nums[i] = uint16(n)
+	}
+
+	return &dns.SRV{
+		Priority: nums[0],
+		Weight:   nums[1],
+		Port:     nums[2],
+		Target:   plugin.Host(fields[3]).Normalize(),
 	}, nil
 }
+
+// parseNAPTR parse NAPTR value in form of "<order> <preference> <flags> <service> <regexp> <replacement>",
+// the flags, service and regexp are character-strings which may be quoted, e.g.
+// 100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .
+func parseNAPTR(value string) (*dns.NAPTR, error) {
+	fields, err := splitQuoted(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("expected \"<order> <preference> <flags> <service> <regexp> <replacement>\", got \"%s\"", value)
+	}
+
+	var nums [2]uint16
+	for i, field := range fields[:2] {
+		n, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number \"%s\"", field)
+		}
+		nums[i] = uint16(n)
+	}
+
+	for _, r := range fields[2] {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return nil, fmt.Errorf("invalid flags \"%s\"", fields[2])
+		}
+	}
+
+	if fields[4] != "" && fields[5] != "." {
+		return nil, fmt.Errorf("only one of regexp and replacement is allowed")
+	}
+
+	return &dns.NAPTR{
+		Order:       nums[0],
+		Preference:  nums[1],
+		Flags:       fields[2],
+		Service:     fields[3],
+		Regexp:      fields[4],
+		Replacement: plugin.Host(fields[5]).Normalize(),
+	}, nil
+}
+
+// splitQuoted split the value into the fields separated by whitespaces,
+// a field in double quotes may hold whitespaces and the escaped quote (\")
+func splitQuoted(value string) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		quoted bool
+		inside bool
+	)
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(value) && value[i+1] == '"':
+			field.WriteByte('"')
+			i++
+		case c == '"':
+			if !quoted && inside {
+				return nil, fmt.Errorf("unexpected quote in \"%s\"", value)
+			}
+			quoted, inside = !quoted, true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inside {
+				fields = append(fields, field.String())
+				field.Reset()
+				inside = false
+			}
+		default:
+			field.WriteByte(c)
+			inside = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in \"%s\"", value)
+	}
+	if inside {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// lookup find the zone records of qname for all types, when there is no exact match
+// it looks for the wildcard records at the closest encloser as described on RFC 4592
+func (zs Zones) lookup(qname string) (map[uint16][]Zone, bool) {
+	if z, ok := zs.Z[qname]; ok {
+		return z, true
+	}
+
+	for i, off := range dns.Split(qname) {
+		if i == 0 {
+			continue
+		}
+
+		parent := qname[off:]
+		if z, ok := zs.Z["*."+parent]; ok {
+			return z, true
+		}
+
+		// the closest encloser exists but have no wildcard
+		if _, ok := zs.Z[parent]; ok {
+			break
+		}
+	}
+
+	return nil, false
+}
+
+// merge copy the records of other into the zones, the records of other
+// override the existing ones with the same name and type, while the settings of other are not copied
+func (zs *Zones) merge(other Zones) {
+	for _, name := range other.Names {
+		if _, ok := zs.Z[name]; !ok {
+			zs.Names = append(zs.Names, name)
+			zs.Z[name] = make(map[uint16][]Zone)
+		}
+
+		// a CNAME cannot coexist with other types, so either of them replace the other
+		node := other.Z[name]
+		if _, ok := node[dns.TypeCNAME]; ok {
+			zs.Z[name] = make(map[uint16][]Zone)
+		} else {
+			delete(zs.Z[name], dns.TypeCNAME)
+		}
+
+		for rrtype, zones := range node {
+			zs.Z[name][rrtype] = zones
+		}
+	}
+}
+
+// typeAllowed report whether the query type is answered by the view as of its allowed and denied types
+func (zs Zones) typeAllowed(qtype uint16) bool {
+	if zs.AllowTypes != nil && !zs.AllowTypes[qtype] {
+		return false
+	}
+	return !zs.DenyTypes[qtype]
+}
+
+// parseQTypes parse the query types of the view, e.g. [ANY, AXFR], the unknown types are
+// reported while the known ones are still returned
+func parseQTypes(types []string) (map[uint16]bool, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	var unknown []string
+	qtypes := make(map[uint16]bool, len(types))
+	for _, t := range types {
+		qtype, ok := dns.StringToType[strings.ToUpper(t)]
+		if !ok {
+			unknown = append(unknown, t)
+			continue
+		}
+		qtypes[qtype] = true
+	}
+
+	if len(unknown) > 0 {
+		return qtypes, fmt.Errorf("unknown query types: %s", strings.Join(unknown, ", "))
+	}
+	return qtypes, nil
+}
+
+// sortByOrder order the records of every name and type by their order ascending, so the answers
+// are deterministic for the clients using the first record, the records without order follow
+// the ordered ones in the config order
+func (zs Zones) sortByOrder() {
+	for _, node := range zs.Z {
+		for _, rrs := range node {
+			sort.SliceStable(rrs, func(i, j int) bool {
+				return rrs[i].Order != nil && (rrs[j].Order == nil || *rrs[i].Order < *rrs[j].Order)
+			})
+		}
+	}
+}
+
+// exists report whether qname exists in the zones, either as the owner of records
+// or as an empty non-terminal which only exists because of the names below it
+func (zs Zones) exists(qname string) bool {
+	if _, ok := zs.Z[qname]; ok {
+		return true
+	}
+	if zs.ents != nil {
+		return zs.ents[qname]
+	}
+
+	for _, name := range zs.Names {
+		if dns.IsSubDomain(qname, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// emptyNonTerminals return every name above the names of the zones, which exists
+// even though it owns no record
+func (zs Zones) emptyNonTerminals() map[string]bool {
+	ents := make(map[string]bool)
+	for _, name := range zs.Names {
+		for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+			ents[name[off:]] = true
+		}
+	}
+	return ents
+}
+
+// delegation find the NS records of the topmost delegation point at or above qname,
+// the apex of the zone itself is never considered as a delegation point
+func (zs Zones) delegation(qname, apex string) ([]Zone, bool) {
+	var found []Zone
+
+	for off, end := 0, false; !end; off, end = dns.NextLabel(qname, off) {
+		name := qname[off:]
+		if name == apex {
+			break
+		}
+
+		if ns := zs.Z[name][dns.TypeNS]; len(ns) > 0 {
+			found = ns
+		}
+	}
+
+	return found, len(found) > 0
+}
+
+// soa return the SOA record of the view for the given zone apex,
+// when the view does not declare one it is synthesized with the default values
+func (zs Zones) soa(apex string) *dns.SOA {
+	var rr *dns.SOA
+	if zs.SOA != nil {
+		rr = dns.Copy(zs.SOA).(*dns.SOA)
+	} else {
+		rr = &dns.SOA{
+			Hdr:     dns.RR_Header{Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: defaultSOATTL},
+			Ns:      dnsutil.Join("ns.dns", apex),
+			Mbox:    dnsutil.Join("hostmaster", apex),
+			Refresh: defaultSOARefresh,
+			Retry:   defaultSOARetry,
+			Expire:  defaultSOAExpire,
+			Minttl:  defaultSOAMinTTL,
+		}
+	}
+
+	// the tracked serial is bumped on every change of the records, so it wins over the configured one
+	// that would be never bumped, unless the configured one is still ahead of the tracked one
+	rr.Hdr.Name = apex
+	if zs.Serial > rr.Serial {
+		rr.Serial = zs.Serial
+	}
+
+	return rr
+}
+
+// negativeSOA return the SOA record of the view for the negative response (NXDOMAIN and NODATA),
+// its TTL is the lesser of the SOA TTL and minimum as described on RFC 2308,
+// which is how long the resolvers cache the negative response
+func (zs Zones) negativeSOA(apex string) *dns.SOA {
+	rr := zs.soa(apex)
+	if rr.Minttl < rr.Hdr.Ttl {
+		rr.Hdr.Ttl = rr.Minttl
+	}
+	return rr
+}
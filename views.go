@@ -2,137 +2,722 @@ package views
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
 	"github.com/coredns/coredns/plugin/pkg/fall"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/rcode"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/request"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/miekg/dns"
 )
 
+// minimizeAnyTTL is the TTL of the synthesized HINFO record answering the minimized ANY query
+const minimizeAnyTTL = 3789
+
+// maxCNAMEChase is the maximum number of CNAME hops followed to answer a query
+const maxCNAMEChase = 8
+
+// serverRestricted is added to the prefix length of the client ACL restricted to the server prefixes,
+// so it outranks the longest prefix of the unrestricted client ACLs
+const serverRestricted = 129
+
+// errCNAMEChase is returned when the CNAME chain loops or is too long to be followed
+var errCNAMEChase = errors.New("CNAME chain is too long or loops")
+
 // Views represent of plugin that route dns resolving based on user IP
 type Views struct {
 	Next           plugin.Handler
+	Zones          []string
 	Fall           fall.F
 	Upstream       *upstream.Upstream
 	ReloadInterval time.Duration
+	HTTPTimeout    time.Duration
+	HTTPRetries    int
+	MinTTL         uint32
+	MaxTTL         uint32
+	Fallback       string
+	UseECS         bool
+	MinimizeAny    bool
+	Strict         bool
+	// Local tells the loopback names (e.g. localhost) are answered regardless of the view
+	Local bool
+	// ValidateOnStartup tells the first load is done on setup, failing it when any source is failed
+	ValidateOnStartup bool
+	// NoMatchPolicy is the response to the clients matched to no view, when it is empty
+	// the fallback view is used if any, otherwise it depends on the fallthrough zones
+	NoMatchPolicy string
+	Admin         string
+	TransferTo    []*net.IPNet
+	// Allow and Deny is the sources which may query the plugin at all, regardless of the views,
+	// a source in both of them is denied and any source is allowed when Allow is empty
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+	// TransferKeys is the TSIG keys by their name, which are required to sign the transfers when given
+	TransferKeys map[string]TransferKey
+	// TransferListen is the address of the transfer listener, which serves the signed transfers
+	TransferListen string
+	// NotifyTo is the secondaries which are notified once their view is changed by the reload
+	NotifyTo []string
+	// MaxAnswers is the maximum answers of a name in the reply, and MaxRecords is the maximum records
+	// of a view on load, zero means no maximum
+	MaxAnswers int
+	MaxRecords int
+	// SlowReloadThreshold is how long a reload may take before its steps are logged, zero disables it
+	SlowReloadThreshold time.Duration
+	// HTTPUserAgent is the User-Agent of the requests to the HTTP and Consul sources, empty means the Go default
+	HTTPUserAgent string
+	// NamePrecedence tells whether the query name is matched to the name patterns of the views
+	// before the client (name) or only when no client is matched (client), the default is client
+	NamePrecedence string
+	// DNS64 is the NAT64 prefix of the views which have the AAAA records synthesized
+	DNS64 map[string]*net.IPNet
+	// NoCompress tells the names of the replies are not compressed, which is set by compress off
+	NoCompress bool
+	// CookieSecret is the secret of the server cookies (RFC 7873) issued to the clients, nil disables cookies
+	CookieSecret []byte
+	// Rewriters is the post-processing of the replies of each view, by the view name
+	Rewriters map[string][]AnswerRewriter
+	// RateLimit is the rate limit of every view, and ViewRateLimits is the one of the given views
+	RateLimit      RateLimit
+	ViewRateLimits map[string]RateLimit
+
+	Clients []*Source
+	Records []*Source
+	// Configs is the sources of the combined documents holding both of the clients and records
+	Configs []*Source
+
+	// config holds the *snapshot of the loaded clients and views, which is replaced on every reload
+	config atomic.Value
+	// reloadMu serializes the reloads which may be triggered from several places
+	reloadMu sync.Mutex
+
+	// signer signs the responses of every view, and viewSigners the one of the given views
+	signer      *signer
+	viewSigners map[string]*signer
 
-	Client       string
-	ClientSchema string
-	Record       string
-	RecordSchema string
+	// ctx is cancelled on shutdown, so the in-flight fetches of the sources are aborted promptly
+	ctx    context.Context
+	cancel context.CancelFunc
 
-	ClientACLs  []*ClientACL
-	ClientZones map[string]Zones
+	limiter        rateLimiter
+	trigger        chan chan error
+	adminListener  net.Listener
+	transferServer *dns.Server
+	watcher        *fsnotify.Watcher
 }
 
 // ServeDNS implements the plugin.Handler interface.
-func (v Views) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+func (v *Views) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (code int, err error) {
 	state := request.Request{W: w, Req: r}
 
-	var (
-		wg      sync.WaitGroup
-		answers []dns.RR
-	)
+	server := metrics.WithServer(ctx)
 
-	answersCh := make(chan []dns.RR)
-	errCh := make(chan error)
-	doneCh := make(chan bool, 1)
+	// the request is counted once the response code is known, whether it is answered by a view or not,
+	// then the view is empty for the request which is not matched to any view
+	view := ""
+	defer func() {
+		requestCount.WithLabelValues(server, view, qTypeLabel(state.QType()), rcode.ToString(code)).Inc()
+	}()
 
-	go func() {
-		defer close(answersCh)
-		defer close(errCh)
+	// the global allow and deny lists are enforced before matching any view
+	if !v.queryAllowed(state) {
+		blockedCount.WithLabelValues(server).Inc()
 
-		wg.Wait()
-		doneCh <- true
-	}()
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		if err := w.WriteMsg(m); err != nil {
+			log.Error(err)
+		}
+		return dns.RcodeRefused, nil
+	}
 
-	for _, client := range v.ClientACLs {
-		wg.Add(1)
-		go client.lookup(ctx, state, &v, &wg, answersCh, errCh)
+	if v.Local {
+		if code, ok := v.local(w, state); ok {
+			return code, nil
+		}
 	}
 
-	for {
-		select {
-		case answers = <-answersCh:
-			// when we got an answers, response with the message
-			if len(answers) > 0 {
-				goto Message
+	// the snapshot is loaded once so the whole query is answered from the same config
+	snap := v.current()
+
+	// the EDNS0 options understood by the plugin are echoed in the responses of the views,
+	// while the next plugins answer with the original writer
+	next := w
+	options, err := v.ednsOptions(state, time.Now())
+	if err != nil {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeFormatError)
+		if err := w.WriteMsg(m); err != nil {
+			log.Error(err)
+		}
+		return dns.RcodeFormatError, nil
+	}
+	if r.IsEdns0() != nil {
+		w = &ednsWriter{ResponseWriter: w, state: state, options: options}
+	}
+
+	clientNet := v.clientNet(state)
+
+	if clog.D.Value() {
+		defer func() { logQuery(state, clientNet, view, code, err) }()
+	}
+
+	client, cidrNet := matchClient(snap.clientACLs, clientNet, serverIP(state))
+	if nameView, pattern := v.nameView(snap, state.Name(), client != nil); nameView != "" {
+		log.Infof("(%s) found match for query name with pattern: %s for user IP (%s) (%s)", nameView, pattern, clientNet.String(), state.QName())
+		view = nameView
+	} else if client != nil {
+		view = client.view(clientNet)
+		log.Infof("(%s) found match for user IP (%s) with registered client CIDR prefixes: %s (%s)", view, clientNet.String(), cidrNet.String(), state.QName())
+	} else if v.Fallback != "" {
+		view = v.Fallback
+		unmatchedCount.WithLabelValues(server).Inc()
+		log.Infof("(%s) no match for user IP (%s), using fallback view (%s)", view, clientNet.String(), state.QName())
+	} else {
+		// when no client is matched, then it is answered as of the no match policy
+		unmatchedCount.WithLabelValues(server).Inc()
+		switch v.noMatchPolicy(state.Name()) {
+		case NoMatchFallthrough:
+			return plugin.NextOrFailure(v.Name(), v.Next, ctx, next, r)
+		case NoMatchRefuse:
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			if err := w.WriteMsg(m); err != nil {
+				log.Error(err)
 			}
-			// if answers is empty, then go to the next plugin
-			return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
-		case err := <-errCh:
-			// when we caught an error,
-			// then go to the next plugin
+			return dns.RcodeRefused, nil
+		}
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Authoritative = true
+		if apex := plugin.Zones(v.Zones).Matches(state.Name()); apex != "" {
+			m.Ns = append(m.Ns, Zones{}.negativeSOA(apex))
+		}
+
+		v.clampTTL(snap, view, m)
+
+		if err := w.WriteMsg(m); err != nil {
 			log.Error(err)
-			return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
-		case <-doneCh:
-			// when the process is done and not giving any result,
-			// then go to the next plugin
-			return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
 		}
+		return dns.RcodeNameError, nil
+	}
 
+	if limit, ok := v.rateLimit(view); ok && !v.limiter.allow(view, limit, time.Now()) {
+		rateLimitedCount.WithLabelValues(server, view).Inc()
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		if err := w.WriteMsg(m); err != nil {
+			log.Error(err)
+		}
+		return dns.RcodeRefused, nil
 	}
 
-Message:
-	m := new(dns.Msg)
-	m.SetReply(r)
-	m.Authoritative = true
-	m.Answer = answers
+	if !snap.clientZones[view].typeAllowed(state.QType()) {
+		deniedCount.WithLabelValues(server, view, qTypeLabel(state.QType())).Inc()
+		log.Infof("(%s) query type %s is denied for user IP (%s) (%s)", view, state.Type(), clientNet.String(), state.QName())
 
-	err := w.WriteMsg(m)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		if err := w.WriteMsg(m); err != nil {
+			log.Error(err)
+		}
+		return dns.RcodeRefused, nil
+	}
+
+	if qtype := state.QType(); qtype == dns.TypeAXFR || qtype == dns.TypeIXFR {
+		return v.transfer(ctx, w, r, state, snap, view)
+	}
+
+	m, err := v.resolve(ctx, state, snap, view)
+	if err == errCNAMEChase {
+		return dns.RcodeServerFailure, err
+	}
 	if err != nil {
+		// when we caught an error,
+		// then go to the next plugin
 		log.Error(err)
-		return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
+		return plugin.NextOrFailure(v.Name(), v.Next, ctx, next, r)
 	}
 
-	return dns.RcodeSuccess, nil
+	// if answers is empty, then go to the next plugin
+	if len(m.Answer) == 0 && len(m.Ns) == 0 {
+		return plugin.NextOrFailure(v.Name(), v.Next, ctx, next, r)
+	}
+
+	v.rewrite(state, view, m)
+	v.capAnswers(m)
+	v.glue(snap, view, state.QType(), m)
+	v.clampTTL(snap, view, m)
+
+	// the authoritative answers are signed online when the client is DNSSEC aware, which are only the ones
+	// answered from the zones of the view as the names out of the zones are forwarded to the upstream
+	if s := v.signerOf(view); s != nil && state.Do() && m.Authoritative {
+		if apex := plugin.Zones(v.Zones).Matches(state.Name()); apex != "" {
+			m = s.sign(state, m, apex, server)
+		}
+	}
+
+	// the reply is compressed unless compress is off, while the scrub writer of the server compresses the reply
+	// exceeding the EDNS UDP size of the client (or 512 without EDNS) anyway, then truncates it with the TC bit set
+	// so the client retries over TCP, the plugin never truncates it, so ServeDNS called directly without
+	// the scrub writer writes the whole reply
+	m.Compress = !v.NoCompress
+	err = w.WriteMsg(m)
+	if err != nil {
+		log.Error(err)
+		return plugin.NextOrFailure(v.Name(), v.Next, ctx, next, r)
+	}
+
+	return m.Rcode, nil
 
 }
 
-func (c *ClientACL) lookup(ctx context.Context, state request.Request, v *Views, wg *sync.WaitGroup, answersCh chan []dns.RR, errCh chan error) {
-	defer wg.Done()
+// noMatchPolicy return the policy of the unmatched client querying the name, without the explicit policy
+// the name goes to the next plugin if fallthrough is enabled for it, otherwise the name does not exist for the client
+func (v *Views) noMatchPolicy(qname string) string {
+	if v.NoMatchPolicy != "" {
+		return v.NoMatchPolicy
+	}
+	if v.Fall.Through(qname) {
+		return NoMatchFallthrough
+	}
+	return NoMatchNXDomain
+}
 
-	qname := state.QName()
-	qtype := state.QType()
-	userIP := net.ParseIP(state.IP())
+// queryLog represent of the debug log entry of the matching decision of a query
+type queryLog struct {
+	Client string `json:"client"`
+	View   string `json:"view"`
+	QName  string `json:"qname"`
+	QType  string `json:"qtype"`
+	RCode  string `json:"rcode"`
+	Error  string `json:"error,omitempty"`
+}
 
-	for _, cidrNet := range c.CIDRNets {
-		wg.Add(1)
-		go func(cidrNet *net.IPNet) {
-			defer wg.Done()
+// logQuery write the matching decision of the query as a JSON debug log,
+// the view is empty when the client is matched to none of the views
+func logQuery(state request.Request, clientNet *net.IPNet, view string, code int, err error) {
+	entry := queryLog{
+		Client: clientNet.String(),
+		View:   view,
+		QName:  state.QName(),
+		QType:  state.Type(),
+		RCode:  rcode.ToString(code),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
 
-			if cidrNet.Contains(userIP) {
-				z, ok := v.ClientZones[c.Name].Z[qname]
-				if !ok {
-					errCh <- fmt.Errorf("no zone was found. Zone: %s", qname)
+	b, e := json.Marshal(entry)
+	if e != nil {
+		return
+	}
+	log.Debug(string(b))
+}
+
+// matchClient return the client ACL along with its CIDR prefix that contains the client network,
+// when several client ACLs are matched the most specific prefix wins,
+// and ties are broken by the config order, the disabled client ACLs are never matched,
+// the client ACL with the server prefixes is only matched when the server IP is within one of them,
+// then it is more specific than any client ACL without those, as if its CIDR prefix is ::/0 when it has none
+func matchClient(clientACLs []*ClientACL, clientNet *net.IPNet, serverIP net.IP) (*ClientACL, *net.IPNet) {
+	var (
+		matched    *ClientACL
+		matchedNet *net.IPNet
+		longest    = -1
+	)
+
+	for _, client := range clientACLs {
+		if client.Disabled {
+			continue
+		}
+
+		// the client restricted to the server prefixes takes precedence over any unrestricted one
+		var restricted int
+		if len(client.ServerNets) > 0 {
+			serverNet := containsIP(client.ServerNets, serverIP)
+			if serverNet == nil {
+				continue
+			}
+			restricted = serverRestricted
+			if len(client.CIDRNets) == 0 {
+				if restricted > longest {
+					matched, matchedNet, longest = client, serverNet, restricted
 				}
+				continue
+			}
+		}
 
-				log.Infof("(%s) found match for user IP (%s) with registered client CIDR prefixes: %s (%s)", c.Name, userIP.String(), cidrNet.String(), qname)
+		for _, cidrNet := range client.CIDRNets {
+			if !containsNet(cidrNet, clientNet) {
+				continue
+			}
 
-				var answers []dns.RR
-				rr := new(dns.CNAME)
-				rr.Hdr = dns.RR_Header{Name: qname, Rrtype: z.Type, Class: state.QClass(), Ttl: z.TTL}
-				rr.Target = z.Value
+			if ones, _ := cidrNet.Mask.Size(); restricted+ones > longest {
+				matched, matchedNet, longest = client, cidrNet, restricted+ones
+			}
+		}
+	}
 
-				answers = append(answers, rr)
+	return matched, matchedNet
+}
 
-				switch qtype {
-				case dns.TypeCNAME:
-				default:
-					rrs := v.doLookup(ctx, state, z.Value, qtype)
-					answers = append(answers, rrs...)
-				}
+// containsIP return the first of the networks that contains the IP, it is nil when none contains it
+func containsIP(nets []*net.IPNet, ip net.IP) *net.IPNet {
+	if ip == nil {
+		return nil
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return n
+		}
+	}
+	return nil
+}
+
+// serverIP return the local IP address which receives the query
+func serverIP(state request.Request) net.IP {
+	ip := net.ParseIP(state.LocalIP())
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// clientNet return the network of the user who send the query,
+// it is taken from EDNS0 Client Subnet option when enabled and present,
+// otherwise it is the user IP itself
+func (v *Views) clientNet(state request.Request) *net.IPNet {
+	if _, subnet := v.clientSubnet(state.Req); subnet != nil {
+		return subnet
+	}
+	return hostNet(net.ParseIP(state.IP()))
+}
+
+// clientSubnet return the EDNS0 Client Subnet option of the query along with its network when enabled,
+// both are nil when the option is absent or not valid
+func (v *Views) clientSubnet(r *dns.Msg) (*dns.EDNS0_SUBNET, *net.IPNet) {
+	if !v.UseECS {
+		return nil, nil
+	}
+
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil, nil
+	}
+	for _, o := range opt.Option {
+		ecs, ok := o.(*dns.EDNS0_SUBNET)
+		if !ok {
+			continue
+		}
+
+		ip, bits := ecs.Address.To16(), 128
+		if ecs.Family == 1 {
+			ip, bits = ecs.Address.To4(), 32
+		}
+		if ip == nil || int(ecs.SourceNetmask) > bits {
+			break
+		}
 
-				answersCh <- answers
+		mask := net.CIDRMask(int(ecs.SourceNetmask), bits)
+		return ecs, normalizeNet(&net.IPNet{IP: ip.Mask(mask), Mask: mask})
+	}
+	return nil, nil
+}
+
+// hostNet return the single host network of the IP address,
+// the IPv4-mapped IPv6 address of a client on a dual-stack socket is unwrapped by To4
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// normalizeNet return the IPv4 network of an IPv4-mapped IPv6 network (::ffff:0:0/96),
+// so it is matched against the IPv4 CIDR prefixes, any other network is returned as is
+func normalizeNet(n *net.IPNet) *net.IPNet {
+	ones, bits := n.Mask.Size()
+	if bits != 128 || ones < 96 {
+		return n
+	}
+
+	ip4 := n.IP.To4()
+	if ip4 == nil {
+		return n
+	}
+
+	return &net.IPNet{IP: ip4, Mask: net.CIDRMask(ones-96, 32)}
+}
+
+// containsNet report whether the whole of network n is within cidrNet,
+// a network which is wider than cidrNet is never considered as a match
+func containsNet(cidrNet, n *net.IPNet) bool {
+	cidrOnes, cidrBits := cidrNet.Mask.Size()
+	ones, bits := n.Mask.Size()
+	return cidrBits == bits && ones >= cidrOnes && cidrNet.Contains(n.IP)
+}
+
+// resolve build the reply message for the query from the given view zones of the snapshot
+func (v *Views) resolve(ctx context.Context, state request.Request, snap *snapshot, view string) (*dns.Msg, error) {
+	// the name is looked up in lowercase as the records are normalized on load,
+	// while the answers are owned by the name in its original casing (0x20 randomization)
+	qname := state.Name()
+	owner := state.QName()
+	qtype := state.QType()
+
+	// the name which does not exist in the view is answered by its closest parent having the name
+	zones := snap.clientZones[ownerView(snap.clientZones, view, qname)]
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+
+	apex := plugin.Zones(v.Zones).Matches(qname)
+
+	// when the query name is at or below a delegation point,
+	// refer the client to the delegated name servers
+	if ns, ok := zones.delegation(qname, apex); ok {
+		for _, z := range ns {
+			m.Ns = append(m.Ns, dns.Copy(z.RR))
+		}
+		return m, nil
+	}
+
+	// the names below a DNAME owner are redirected into its target
+	if z, ok := zones.dname(qname, apex); ok {
+		return v.synthesizeDNAME(ctx, state, snap, view, z)
+	}
+
+	if qtype == dns.TypeSOA && qname == apex {
+		m.Authoritative = true
+		m.Answer = append(m.Answer, zones.soa(apex))
+		return m, nil
+	}
+
+	if s := v.signerOf(view); s != nil && qtype == dns.TypeDNSKEY && qname == apex {
+		m.Authoritative = true
+		m.Answer = s.dnskey(apex)
+		return m, nil
+	}
+
+	node, ok := zones.lookup(qname)
+	if !ok && apex == "" && len(zones.Upstream) > 0 {
+		// the name is out of the zones of the view, then forward it to the upstream of the view,
+		// while the missing names within the zones are still answered authoritatively below
+		return forward(ctx, state, zones.Upstream)
+	}
+	if !ok {
+		// the name is not owned by the view, then go to the next plugin
+		// when it is out of the zones or fallthrough is enabled for it
+		if apex == "" || v.Fall.Through(qname) {
+			return nil, fmt.Errorf("no zone was found. Zone: %s", qname)
+		}
+
+		// the name does not exist at all (NXDOMAIN), unless it is an empty non-terminal
+		if !zones.exists(qname) {
+			m.Authoritative = true
+			m.Rcode = dns.RcodeNameError
+			m.Ns = append(m.Ns, zones.negativeSOA(apex))
+			return m, nil
+		}
+	}
+
+	if qtype == dns.TypeANY && len(node) > 0 {
+		m.Authoritative = true
+		m.Answer = v.answerAny(owner, node)
+		return m, nil
+	}
+
+	// a CNAME is answered for any type which is not owned by the name
+	zs, ok := node[qtype]
+	if !ok && qtype == dns.TypeAAAA {
+		if synthesized := v.dns64(view, node); len(synthesized) > 0 {
+			zs, ok = synthesized, true
+		}
+	}
+	if !ok {
+		zs = node[dns.TypeCNAME]
+	}
+	zs = pickWeighted(zs)
+
+	m.Authoritative = true
+	for _, z := range zs {
+		rr := dns.Copy(z.RR)
+		rr.Header().Name = owner
+
+		m.Answer = append(m.Answer, rr)
+
+		// only CNAME target need to be resolved further
+		if z.Type == dns.TypeCNAME && qtype != dns.TypeCNAME {
+			rrs, err := v.chase(ctx, state, snap, view, z.Value, qtype)
+			if err != nil {
+				return nil, err
 			}
-		}(cidrNet)
+			m.Answer = append(m.Answer, rrs...)
+		}
+	}
+
+	// the name exists but not for the requested type (NODATA),
+	// the SOA is attached so the negative response can be cached
+	if len(m.Answer) == 0 && apex != "" {
+		m.Ns = append(m.Ns, zones.negativeSOA(apex))
 	}
+
+	return m, nil
+}
+
+// answerAny return every record owned by the name ordered by its type,
+// or a single synthesized HINFO record when the ANY response is minimized as described on RFC 8482
+func (v *Views) answerAny(qname string, node map[uint16][]Zone) []dns.RR {
+	if v.MinimizeAny {
+		return []dns.RR{&dns.HINFO{
+			Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeHINFO, Class: dns.ClassINET, Ttl: minimizeAnyTTL},
+			Cpu: "RFC8482",
+		}}
+	}
+
+	qtypes := make([]int, 0, len(node))
+	for qtype := range node {
+		qtypes = append(qtypes, int(qtype))
+	}
+	sort.Ints(qtypes)
+
+	var rrs []dns.RR
+	for _, qtype := range qtypes {
+		for _, z := range pickWeighted(node[uint16(qtype)]) {
+			rr := dns.Copy(z.RR)
+			rr.Header().Name = qname
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+// clampTTL clamp the TTL of every record on the message into the configured range,
+// the range of the view takes precedence over the one of the plugin
+func (v *Views) clampTTL(snap *snapshot, view string, m *dns.Msg) {
+	zones := snap.clientZones[view]
+
+	minTTL, maxTTL := v.MinTTL, v.MaxTTL
+	if zones.MinTTL != 0 {
+		minTTL = zones.MinTTL
+	}
+	if zones.MaxTTL != 0 {
+		maxTTL = zones.MaxTTL
+	}
+
+	if minTTL == 0 && maxTTL == 0 {
+		return
+	}
+
+	for _, rrs := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+
+			if minTTL != 0 && hdr.Ttl < minTTL {
+				hdr.Ttl = minTTL
+			}
+			if maxTTL != 0 && hdr.Ttl > maxTTL {
+				hdr.Ttl = maxTTL
+			}
+		}
+	}
+}
+
+// chainKey is the context key of the CNAME chain being resolved through the upstream
+type chainKey struct{}
+
+// chain represent of the CNAME chain being resolved,
+// the upstream query goes back into the server so the chain is carried on the context,
+// and failed is shared to report a broken chain back from the nested queries
+type chain struct {
+	names  []string
+	failed *bool
+}
+
+// chase follow the CNAME target within the view or its parents as long as the target is owned by them,
+// and through the upstream otherwise, a chain which loops or exceeds maxCNAMEChase hops is failed
+func (v *Views) chase(ctx context.Context, state request.Request, snap *snapshot, view, target string, qtype uint16) ([]dns.RR, error) {
+	c, ok := ctx.Value(chainKey{}).(chain)
+	if !ok {
+		c.failed = new(bool)
+	}
+
+	// the capacity is capped so the names of the caller are never overwritten
+	names := append(c.names[:len(c.names):len(c.names)], state.Name())
+
+	var rrs []dns.RR
+	for {
+		for _, name := range names {
+			if name == target {
+				log.Errorf("CNAME loop detected: %s -> %s", strings.Join(names, " -> "), target)
+				*c.failed = true
+				return nil, errCNAMEChase
+			}
+		}
+
+		if len(names) > maxCNAMEChase {
+			log.Errorf("CNAME chain exceeds %d hops: %s -> %s", maxCNAMEChase, strings.Join(names, " -> "), target)
+			*c.failed = true
+			return nil, errCNAMEChase
+		}
+
+		if plugin.Zones(v.Zones).Matches(target) == "" {
+			break
+		}
+
+		zones := snap.clientZones[ownerView(snap.clientZones, view, target)]
+
+		node, ok := zones.lookup(target)
+		if !ok {
+			break
+		}
+
+		zs, ok := node[qtype]
+		if !ok {
+			zs = node[dns.TypeCNAME]
+		}
+		zs = pickWeighted(zs)
+
+		for _, z := range zs {
+			rr := dns.Copy(z.RR)
+			rr.Header().Name = target
+			rrs = append(rrs, rr)
+		}
+
+		if len(zs) == 0 || zs[0].Type != dns.TypeCNAME || qtype == dns.TypeCNAME {
+			return rrs, nil
+		}
+
+		names = append(names, target)
+		target = zs[0].Value
+	}
+
+	ctx = context.WithValue(ctx, chainKey{}, chain{names: names, failed: c.failed})
+	up := v.doLookup(ctx, state, target, qtype)
+	if *c.failed {
+		return nil, errCNAMEChase
+	}
+
+	return append(rrs, up...), nil
 }
 
 func (v *Views) doLookup(ctx context.Context, state request.Request, target string, qtype uint16) []dns.RR {
@@ -156,4 +741,4 @@ func (v *Views) doLookup(ctx context.Context, state request.Request, target stri
 }
 
 // Name implements the Handler interface.
-func (v Views) Name() string { return "views" }
+func (v *Views) Name() string { return "views" }
@@ -0,0 +1,591 @@
+package views
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func init() { clog.Discard() }
+
+// testClients is the client of the test.ResponseWriter (10.240.0.1) matched to the internal view
+const testClients = `
+- name: internal
+  prefixes: ["10.240.0.0/16"]
+`
+
+// newTestViews return the views of example.org. loaded from the records of the internal view
+func newTestViews(tb testing.TB, records string) *Views {
+	tb.Helper()
+
+	dir, err := ioutil.TempDir("", "views")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { os.RemoveAll(dir) })
+
+	v := &Views{
+		Zones:   []string{"example.org."},
+		Clients: []*Source{{Path: writeTestFile(tb, dir, "clients.yaml", testClients), Schema: SchemaYAML}},
+		Records: []*Source{{Path: writeTestFile(tb, dir, "records.yaml", records), Schema: SchemaYAML}},
+	}
+
+	if err := v.loadConfig(); err != nil {
+		tb.Fatal(err)
+	}
+	return v
+}
+
+// writeTestFile write the content into the file of the directory, and return its path
+func writeTestFile(tb testing.TB, dir, name, content string) string {
+	tb.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// testRecords return the records of the internal view holding the A record of www.example.org.
+func testRecords(ip string) string {
+	return fmt.Sprintf(`
+- name: internal
+  records:
+    - {name: www.example.org., ttl: 60, type: A, value: %s}
+`, ip)
+}
+
+// poolRecords return the records of the internal view holding the given number of A records of the name
+func poolRecords(name string, n int) string {
+	var b strings.Builder
+	b.WriteString("\n- name: internal\n  records:\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "    - {name: %s, ttl: 60, type: A, value: 10.0.%d.%d}\n", name, i/256, i%256)
+	}
+	return b.String()
+}
+
+// serveTest serve the query through the writer, and return the reply it received
+func serveTest(tb testing.TB, v *Views, w dns.ResponseWriter, r *dns.Msg) *dns.Msg {
+	tb.Helper()
+
+	rec := dnstest.NewRecorder(w)
+	if _, err := v.ServeDNS(context.TODO(), rec, r); err != nil {
+		tb.Fatal(err)
+	}
+	if rec.Msg == nil {
+		tb.Fatalf("no reply is written for %s", r.Question[0].Name)
+	}
+	return rec.Msg
+}
+
+// remoteWriter is the test.ResponseWriter of the query sent from the remote IP
+type remoteWriter struct {
+	test.ResponseWriter
+	remote net.IP
+}
+
+// RemoteAddr implements the dns.ResponseWriter interface
+func (w *remoteWriter) RemoteAddr() net.Addr { return &net.UDPAddr{IP: w.remote, Port: 40212} }
+
+func TestMatchClientMappedIPv4(t *testing.T) {
+	clientACLs, err := NewClientACLs([]RawClientACL{
+		{Name: "ipv4", CIDRPrefixes: []string{"10.0.0.0/8"}},
+		{Name: "mapped", CIDRPrefixes: []string{"::ffff:192.168.0.0/112"}},
+		{Name: "ipv6", CIDRPrefixes: []string{"2001:db8::/32"}},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote string
+		view   string
+	}{
+		{remote: "10.0.0.1", view: "ipv4"},
+		{remote: "::ffff:10.0.0.1", view: "ipv4"},
+		{remote: "192.168.1.1", view: "mapped"},
+		{remote: "::ffff:192.168.1.1", view: "mapped"},
+		{remote: "2001:db8::1", view: "ipv6"},
+		// the IPv4-compatible and the other pure IPv6 addresses are never matched to the IPv4 prefixes
+		{remote: "::a00:1", view: ""},
+		{remote: "fe80::a00:1", view: ""},
+	}
+
+	v := new(Views)
+	for _, tc := range tests {
+		state := request.Request{W: &remoteWriter{remote: net.ParseIP(tc.remote)}, Req: new(dns.Msg)}
+
+		var view string
+		if client, _ := matchClient(clientACLs, v.clientNet(state), serverIP(state)); client != nil {
+			view = client.Name
+		}
+		if view != tc.view {
+			t.Errorf("client %s: expected view %q, got %q", tc.remote, tc.view, view)
+		}
+	}
+}
+
+func TestServeDNSDuringReload(t *testing.T) {
+	v := newTestViews(t, testRecords("10.0.0.0"))
+
+	done := make(chan struct{})
+	errs := make(chan error, 8)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				r := new(dns.Msg)
+				r.SetQuestion("www.example.org.", dns.TypeA)
+				rec := dnstest.NewRecorder(&test.ResponseWriter{})
+				if _, err := v.ServeDNS(context.TODO(), rec, r); err != nil {
+					errs <- err
+					return
+				}
+				if rec.Msg == nil || rec.Msg.Rcode != dns.RcodeSuccess || len(rec.Msg.Answer) != 1 {
+					errs <- fmt.Errorf("unexpected reply during reload: %v", rec.Msg)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 50; i++ {
+		writeTestFile(t, filepath.Dir(v.Records[0].Path), "records.yaml", testRecords(fmt.Sprintf("10.0.0.%d", i)))
+		if err := v.loadConfig(); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.org.", dns.TypeA)
+	m := serveTest(t, v, &test.ResponseWriter{}, r)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "10.0.0.50" {
+		t.Errorf("expected the record of the last reload, got %v", m.Answer)
+	}
+}
+
+func BenchmarkServeDNSDuringReload(b *testing.B) {
+	v := newTestViews(b, testRecords("10.0.0.1"))
+
+	// the snapshots are published as fast as possible, so the queries always race with a reload
+	done := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			v.publish(v.current().clone())
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.org.", dns.TypeA)
+		for pb.Next() {
+			if _, err := v.ServeDNS(context.TODO(), &test.ResponseWriter{}, r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+
+	close(done)
+	wg.Wait()
+}
+
+func TestServeDNSForward(t *testing.T) {
+	var forwarded []string
+	var mu sync.Mutex
+	upstream := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		forwarded = append(forwarded, r.Question[0].Name)
+		mu.Unlock()
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, test.A(r.Question[0].Name+" 60 IN A 192.0.2.1"))
+		w.WriteMsg(m)
+	})
+	defer upstream.Close()
+
+	v := newTestViews(t, fmt.Sprintf(`
+- name: internal
+  upstream: ["%s"]
+  records:
+    - {name: www.example.org., ttl: 60, type: A, value: 10.0.0.1}
+`, upstream.Addr))
+
+	// the missing name within the zones is answered authoritatively, and never forwarded
+	r := new(dns.Msg)
+	r.SetQuestion("missing.example.org.", dns.TypeA)
+	m := serveTest(t, v, &test.ResponseWriter{}, r)
+	if m.Rcode != dns.RcodeNameError || !m.Authoritative {
+		t.Errorf("expected the authoritative NXDOMAIN of the missing name, got %v", m)
+	}
+
+	r = new(dns.Msg)
+	r.SetQuestion("www.example.net.", dns.TypeA)
+	m = serveTest(t, v, &test.ResponseWriter{}, r)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+		t.Errorf("expected the reply of the upstream to the name out of the zones, got %v", m)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(forwarded) != 1 || forwarded[0] != "www.example.net." {
+		t.Errorf("expected only the name out of the zones to be forwarded, got %v", forwarded)
+	}
+}
+
+func TestServeDNSMixedCase(t *testing.T) {
+	v := newTestViews(t, `
+- name: internal
+  records:
+    - {name: www.example.org., ttl: 60, type: A, value: 10.0.0.1}
+    - {name: "*.wild.example.org.", ttl: 60, type: A, value: 10.0.0.2}
+    - {name: dname.example.org., ttl: 60, type: DNAME, value: target.example.org.}
+    - {name: host.target.example.org., ttl: 60, type: A, value: 10.0.0.3}
+`)
+
+	tests := []struct {
+		qname  string
+		owners []string
+	}{
+		{qname: "WwW.ExAmPle.OrG.", owners: []string{"WwW.ExAmPle.OrG."}},
+		{qname: "FoO.WiLd.ExAmPle.OrG.", owners: []string{"FoO.WiLd.ExAmPle.OrG."}},
+		// the DNAME is owned by the query casing of its owner, while the synthesized target is lowercase
+		{qname: "HoSt.DnAmE.ExAmPle.OrG.", owners: []string{"DnAmE.ExAmPle.OrG.", "HoSt.DnAmE.ExAmPle.OrG.", "host.target.example.org."}},
+	}
+
+	for _, tc := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, dns.TypeA)
+		m := serveTest(t, v, &test.ResponseWriter{}, r)
+
+		if m.Rcode != dns.RcodeSuccess || len(m.Answer) != len(tc.owners) {
+			t.Errorf("%s: expected %d answers, got %v", tc.qname, len(tc.owners), m)
+			continue
+		}
+		if m.Question[0].Name != tc.qname {
+			t.Errorf("%s: expected the question in the query casing, got %s", tc.qname, m.Question[0].Name)
+		}
+		for i, owner := range tc.owners {
+			if name := m.Answer[i].Header().Name; name != owner {
+				t.Errorf("%s: expected the owner %s of answer %d, got %s", tc.qname, owner, i, name)
+			}
+		}
+	}
+}
+
+func TestServeDNSTruncate(t *testing.T) {
+	v := newTestViews(t, poolRecords("pool.example.org.", 100))
+
+	tests := []struct {
+		edns uint16
+		size int
+	}{
+		{edns: 0, size: dns.MinMsgSize},
+		{edns: 700, size: 700},
+	}
+
+	for _, tc := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion("pool.example.org.", dns.TypeA)
+		if tc.edns > 0 {
+			r.SetEdns0(tc.edns, false)
+		}
+
+		// the reply is truncated by the scrub writer the server wraps around the plugin
+		m := serveTest(t, v, request.NewScrubWriter(r, &test.ResponseWriter{}), r)
+		if !m.Truncated {
+			t.Errorf("EDNS size %d: expected the truncated reply", tc.edns)
+		}
+		if len(m.Answer) == 0 || len(m.Answer) == 100 {
+			t.Errorf("EDNS size %d: expected a part of the answers, got %d", tc.edns, len(m.Answer))
+		}
+
+		b, err := m.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > tc.size {
+			t.Errorf("EDNS size %d: expected the reply within %d bytes, got %d", tc.edns, tc.size, len(b))
+		}
+
+		// without the scrub writer the whole reply is written as the plugin never truncates it
+		r = r.Copy()
+		m = serveTest(t, v, &test.ResponseWriter{}, r)
+		if m.Truncated || len(m.Answer) != 100 {
+			t.Errorf("EDNS size %d: expected the whole of the answers without the scrub writer, got %d (truncated %t)", tc.edns, len(m.Answer), m.Truncated)
+		}
+	}
+}
+
+func TestServeDNSCompress(t *testing.T) {
+	name := "a-rather-long-name-of-the-pool.example.org."
+	v := newTestViews(t, poolRecords(name, 25))
+
+	r := new(dns.Msg)
+	r.SetQuestion(name, dns.TypeA)
+
+	// the reply only fits into the 512 bytes when it is compressed
+	m := serveTest(t, v, request.NewScrubWriter(r, &test.ResponseWriter{}), r)
+	if m.Truncated || len(m.Answer) != 25 {
+		t.Fatalf("expected the whole of the 25 answers untruncated, got %d answers (truncated %t)", len(m.Answer), m.Truncated)
+	}
+	if !m.Compress || m.Len() > dns.MinMsgSize {
+		t.Errorf("expected the compressed reply within %d bytes, got %d (compressed %t)", dns.MinMsgSize, m.Len(), m.Compress)
+	}
+
+	m.Compress = false
+	if m.Len() <= dns.MinMsgSize {
+		t.Errorf("expected the uncompressed reply over %d bytes, got %d", dns.MinMsgSize, m.Len())
+	}
+
+	// without the scrub writer the reply is compressed as of the compress directive
+	for _, noCompress := range []bool{false, true} {
+		v.NoCompress = noCompress
+		m = serveTest(t, v, &test.ResponseWriter{}, r)
+		if m.Compress == noCompress {
+			t.Errorf("compress off %t: expected the compression %t of the reply", noCompress, !noCompress)
+		}
+	}
+}
+
+func TestParseCompress(t *testing.T) {
+	tests := []struct {
+		input      string
+		noCompress bool
+		err        bool
+	}{
+		{input: "", noCompress: false},
+		{input: "compress on", noCompress: false},
+		{input: "compress off", noCompress: true},
+		{input: "compress", err: true},
+		{input: "compress no", err: true},
+	}
+
+	for _, tc := range tests {
+		c := caddy.NewTestController("dns", "views {\n client clients.yaml\n record records.yaml\n "+tc.input+"\n}")
+		v, err := parse(c)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+			continue
+		}
+		if v.NoCompress != tc.noCompress {
+			t.Errorf("%q: expected compress off %t, got %t", tc.input, tc.noCompress, v.NoCompress)
+		}
+	}
+}
+
+func TestLoadConfigKeepsLastGoodHalf(t *testing.T) {
+	records := `
+- name: internal
+  records:
+    - {name: www.example.org., ttl: 60, type: A, value: 10.0.0.1}
+- name: other
+  records:
+    - {name: www.example.org., ttl: 60, type: A, value: 10.0.0.2}
+`
+	tests := []struct {
+		name    string
+		records string
+	}{
+		{name: "malformed records", records: "- name: [internal\n"},
+		{name: "invalid records", records: "- name: internal\n  records: []\n"},
+	}
+
+	for _, tc := range tests {
+		v := newTestViews(t, records)
+		dir := filepath.Dir(v.Records[0].Path)
+
+		// the clients are moved into the other view while the records are broken
+		writeTestFile(t, dir, "records.yaml", tc.records)
+		writeTestFile(t, dir, "clients.yaml", "- name: other\n  prefixes: [\"10.240.0.0/16\"]\n")
+		if err := v.loadConfig(); err == nil {
+			t.Errorf("%s: expected the error of the records", tc.name)
+		}
+
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.org.", dns.TypeA)
+		m := serveTest(t, v, &test.ResponseWriter{}, r)
+		if len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "10.0.0.2" {
+			t.Errorf("%s: expected the new clients along with the last good records, got %v", tc.name, m.Answer)
+		}
+	}
+}
+
+func TestServeDNSCountsUnmatched(t *testing.T) {
+	v := newTestViews(t, testRecords("10.0.0.1"))
+
+	counter := requestCount.WithLabelValues("", "", "A", "NXDOMAIN")
+	before := testutil.ToFloat64(counter)
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.org.", dns.TypeA)
+	m := serveTest(t, v, &remoteWriter{remote: net.ParseIP("192.0.2.1")}, r)
+	if m.Rcode != dns.RcodeNameError {
+		t.Fatalf("expected NXDOMAIN to the unmatched client, got %s", dns.RcodeToString[m.Rcode])
+	}
+
+	if n := testutil.ToFloat64(counter) - before; n != 1 {
+		t.Errorf("expected the unmatched request to be counted once, got %v", n)
+	}
+}
+
+// cookieOf return the DNS cookie of the message, it is nil when the message has none
+func cookieOf(tb testing.TB, m *dns.Msg) []byte {
+	tb.Helper()
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if cookie, ok := o.(*dns.EDNS0_COOKIE); ok {
+			b, err := hex.DecodeString(cookie.Cookie)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			return b
+		}
+	}
+	return nil
+}
+
+func TestServeDNSCookies(t *testing.T) {
+	v := newTestViews(t, testRecords("10.0.0.1"))
+	v.CookieSecret = []byte("0123456789abcdef")
+
+	ip := net.ParseIP("10.240.0.1")
+	now := time.Now()
+	clientCookie := []byte("clientck")
+	withServer := func(server []byte) []byte { return append(append([]byte{}, clientCookie...), server...) }
+
+	tests := []struct {
+		name   string
+		cookie []byte
+		valid  bool
+		rcode  int
+	}{
+		{name: "client cookie", cookie: clientCookie, rcode: dns.RcodeSuccess},
+		{name: "valid server cookie", cookie: withServer(v.serverCookie(clientCookie, ip, uint32(now.Unix()))), valid: true, rcode: dns.RcodeSuccess},
+		{name: "stale server cookie", cookie: withServer(v.serverCookie(clientCookie, ip, uint32(now.Add(-2*cookieMaxAge).Unix()))), rcode: dns.RcodeSuccess},
+		{name: "malformed client cookie", cookie: []byte("short"), rcode: dns.RcodeFormatError},
+		{name: "malformed server cookie", cookie: withServer([]byte("tiny")), rcode: dns.RcodeFormatError},
+	}
+
+	for _, tc := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.org.", dns.TypeA)
+		r.SetEdns0(1232, false)
+		sent := hex.EncodeToString(tc.cookie)
+		opt := r.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: sent})
+
+		if len(tc.cookie) > clientCookieLen {
+			server := tc.cookie[clientCookieLen:]
+			if valid := v.validServerCookie(clientCookie, server, ip, now); valid != tc.valid {
+				t.Errorf("%s: expected the validity %t of the server cookie, got %t", tc.name, tc.valid, valid)
+			}
+		}
+
+		m := serveTest(t, v, &test.ResponseWriter{}, r)
+		if m.Rcode != tc.rcode {
+			t.Errorf("%s: expected %s, got %s", tc.name, dns.RcodeToString[tc.rcode], dns.RcodeToString[m.Rcode])
+			continue
+		}
+
+		// the request is never modified by the options of the response
+		if cookie := opt.Option[len(opt.Option)-1].(*dns.EDNS0_COOKIE).Cookie; cookie != sent || len(opt.Option) != 1 {
+			t.Errorf("%s: expected the cookie of the request to be kept, got %v", tc.name, opt.Option)
+		}
+		if tc.rcode != dns.RcodeSuccess {
+			continue
+		}
+
+		// a fresh server cookie is always issued to the client cookie
+		cookie := cookieOf(t, m)
+		if len(cookie) != clientCookieLen+serverCookieLen || !bytes.Equal(cookie[:clientCookieLen], clientCookie) {
+			t.Errorf("%s: expected the client cookie along with a server cookie, got %x", tc.name, cookie)
+			continue
+		}
+		if !v.validServerCookie(clientCookie, cookie[clientCookieLen:], ip, now) {
+			t.Errorf("%s: expected a valid server cookie, got %x", tc.name, cookie[clientCookieLen:])
+		}
+		if n := len(m.Extra); n != 1 {
+			t.Errorf("%s: expected a single OPT RR, got %d additional records", tc.name, n)
+		}
+	}
+}
+
+func TestServeDNSEchoesBufsize(t *testing.T) {
+	v := newTestViews(t, testRecords("10.0.0.1"))
+
+	for _, size := range []uint16{512, 1232, 4096} {
+		r := new(dns.Msg)
+		r.SetQuestion("www.example.org.", dns.TypeA)
+		r.SetEdns0(size, false)
+
+		m := serveTest(t, v, &test.ResponseWriter{}, r)
+		opt := m.IsEdns0()
+		if opt == nil {
+			t.Errorf("bufsize %d: expected the OPT RR in the response", size)
+			continue
+		}
+		if opt.UDPSize() != size {
+			t.Errorf("bufsize %d: expected the bufsize of the request, got %d", size, opt.UDPSize())
+		}
+		if opt == r.IsEdns0() {
+			t.Errorf("bufsize %d: expected the OPT RR of the response apart from the one of the request", size)
+		}
+	}
+}
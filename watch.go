@@ -0,0 +1,108 @@
+package views
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchDebounce is the time to wait for file events to settle before reloading,
+	// editors usually emit several events for a single save
+	watchDebounce = 500 * time.Millisecond
+)
+
+// watch start watching the file sources and reload the config when any of them is changed,
+// including the files added to or removed from the directory and glob sources,
+// the parent directory is watched instead of the file so renames made by editors are caught as well
+func (v *Views) watch() error {
+	var patterns []string
+	for _, src := range v.sources() {
+		if isFileSchema(src.Schema) {
+			for _, pattern := range yamlPatterns(src.Path) {
+				patterns = append(patterns, filepath.Clean(pattern))
+			}
+		}
+	}
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+	for _, pattern := range patterns {
+		dir := filepath.Dir(pattern)
+		if dirs[dir] {
+			continue
+		}
+		if isGlob(dir) {
+			log.Warningf("glob pattern on the directory is not watched: %s", pattern)
+			continue
+		}
+
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+		dirs[dir] = true
+	}
+
+	go func() {
+		var debounce <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if matchAny(patterns, filepath.Clean(event.Name)) {
+					debounce = time.After(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error(err)
+			case <-debounce:
+				debounce = nil
+				if err := v.loadConfig(); err != nil {
+					log.Error(err)
+				}
+			}
+		}
+	}()
+
+	v.watcher = watcher
+	return nil
+}
+
+// unwatch stop watching the file sources when it is started
+func (v *Views) unwatch() error {
+	if v.watcher == nil {
+		return nil
+	}
+
+	err := v.watcher.Close()
+	v.watcher = nil
+	return err
+}
+
+// matchAny report whether the file is matched by any of the glob patterns
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isFileSchema(schema string) bool {
+	return schema == SchemaYAML || schema == SchemaJSON
+}
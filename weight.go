@@ -0,0 +1,56 @@
+package views
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// weightMu guards weightRNG as the rand.Rand is not safe for concurrent use
+	weightMu  sync.Mutex
+	weightRNG = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// pickWeighted pick a single record among the weighted records of the same name and type by their weight,
+// while the records without weight are always answered alongside it, so weighting some of the values
+// of a multi-value name never drops the others, a zero weight is never picked
+func pickWeighted(zs []Zone) []Zone {
+	var (
+		total    int64
+		weighted bool
+	)
+	for _, z := range zs {
+		if z.Weight != nil {
+			total += int64(*z.Weight)
+			weighted = true
+		}
+	}
+	if !weighted {
+		return zs
+	}
+
+	var n int64 = -1
+	if total > 0 {
+		weightMu.Lock()
+		n = weightRNG.Int63n(total)
+		weightMu.Unlock()
+	}
+
+	picked := make([]Zone, 0, len(zs))
+	for _, z := range zs {
+		if z.Weight == nil {
+			picked = append(picked, z)
+			continue
+		}
+
+		// only the first weighted record crossing the picked number is answered
+		if n >= 0 {
+			n -= int64(*z.Weight)
+			if n < 0 {
+				picked = append(picked, z)
+			}
+		}
+	}
+	return picked
+}